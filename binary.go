@@ -1,45 +1,453 @@
 package binary
 
 import (
+	"bufio"
 	"bytes"
+	"compress/flate"
 	"encoding"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/big"
+	"net"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+	"unsafe"
 )
 
 var (
 	LittleEndian  = binary.LittleEndian
 	BigEndian     = binary.BigEndian
 	DefaultEndian = LittleEndian
+
+	// DefaultMaxLen is the MaxLen given to decoders created by NewDecoder.
+	DefaultMaxLen = 1 << 20
+	// DefaultMaxDepth is the MaxDepth given to decoders created by
+	// NewDecoder.
+	DefaultMaxDepth = 1000
 )
 
+// RawValue holds opaque bytes, such as the encoding of a value produced by
+// Marshal, allowing decoding of it to be deferred or a pre-encoded value to
+// be embedded in another. A RawValue is written as a length prefix followed
+// by its bytes verbatim, whatever codecs are registered, so it can be
+// captured or skipped without knowledge of the type it holds. It does not
+// capture the encoding of a field of some other type in place: the field must
+// be a RawValue when it is written as well as when it is read.
+type RawValue []byte
+
 func Marshal(v interface{}) ([]byte, error) {
+	return marshal(v, DefaultEndian)
+}
+
+// MarshalBigEndian is like Marshal but encodes fixed-size values in
+// big-endian byte order, regardless of DefaultEndian.
+func MarshalBigEndian(v interface{}) ([]byte, error) {
+	return marshal(v, BigEndian)
+}
+
+func marshal(v interface{}, order binary.ByteOrder) ([]byte, error) {
 	b := &bytes.Buffer{}
-	if err := NewEncoder(b).Encode(v); err != nil {
+	b.Grow(sizeHint(v))
+	enc := NewEncoder(b)
+	enc.Order = order
+	if err := enc.Encode(v); err != nil {
 		return nil, err
 	}
 	return b.Bytes(), nil
 }
 
+// MarshalAppend appends the encoding of v to dst and returns the extended
+// slice.
+func MarshalAppend(dst []byte, v interface{}) ([]byte, error) {
+	b := bytes.NewBuffer(dst)
+	if err := NewEncoder(b).Encode(v); err != nil {
+		return dst, err
+	}
+	return b.Bytes(), nil
+}
+
+// MarshalTo writes the encoding of v into buf and returns the number of bytes
+// written. If buf is too small io.ErrShortBuffer is returned. Nothing is
+// written past the end of buf, but its contents are then unspecified.
+func MarshalTo(buf []byte, v interface{}) (int, error) {
+	w := &boundedWriter{buf: buf}
+	if err := NewEncoder(w).Encode(v); err != nil {
+		return 0, err
+	}
+	if w.n > len(buf) {
+		return 0, io.ErrShortBuffer
+	}
+	return w.n, nil
+}
+
+// boundedWriter writes into a fixed buffer. Once the buffer is full it only
+// counts what is written, so that encoding still runs to completion and any
+// encoding error takes precedence over the buffer being too small.
+type boundedWriter struct {
+	buf []byte
+	n   int
+}
+
+func (w *boundedWriter) Write(p []byte) (int, error) {
+	if w.n < len(w.buf) {
+		copy(w.buf[w.n:], p)
+	}
+	w.n += len(p)
+	return len(p), nil
+}
+
+func (w *boundedWriter) WriteString(s string) (int, error) {
+	if w.n < len(w.buf) {
+		copy(w.buf[w.n:], s)
+	}
+	w.n += len(s)
+	return len(s), nil
+}
+
+// Size returns the number of bytes Marshal would produce for v, without
+// buffering the encoded output. It encodes v to count the bytes, so it costs
+// about as much as Marshal and calls any marshalers and PreMarshal hooks.
+func Size(v interface{}) (int, error) {
+	w := &countingWriter{}
+	if err := NewEncoder(w).Encode(v); err != nil {
+		return 0, err
+	}
+	return w.n, nil
+}
+
+// sizeHint returns the size of the encoding of v by an Encoder with the
+// default settings if it can be found without encoding v, or zero otherwise.
+// This is only attempted for fixed-size values and slices of them, for which
+// it is cheap, so that Marshal can allocate its buffer once.
+func sizeHint(v interface{}) int {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return 0
+	}
+	t := rv.Type()
+	if n := fixedSize(t); n >= 0 {
+		return n
+	}
+	if t.Kind() != reflect.Slice || typeFlags(t) != 0 {
+		return 0
+	}
+	if _, ok := lookupCodec(t); ok {
+		return 0
+	}
+	n := fixedSize(t.Elem())
+	l := rv.Len()
+	if n < 0 || (n > 0 && l > (math.MaxInt-binary.MaxVarintLen64)/n) {
+		return 0
+	}
+	var prefix [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(prefix[:], uint64(l)) + l*n
+}
+
+// fixedSize returns the size of the encoding of every value of type t by an
+// Encoder with the default settings, or -1 if t is not a boolean or number,
+// or an array of them, encoded in the usual way.
+func fixedSize(t reflect.Type) int {
+	if typeFlags(t) != 0 {
+		return -1
+	}
+	if _, ok := lookupCodec(t); ok {
+		return -1
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		return 1
+	case reflect.Int16, reflect.Uint16:
+		return 2
+	case reflect.Int32, reflect.Uint32, reflect.Float32:
+		return 4
+	case reflect.Int, reflect.Uint, reflect.Uintptr, reflect.Int64, reflect.Uint64,
+		reflect.Float64, reflect.Complex64:
+		return 8
+	case reflect.Complex128:
+		return 16
+	case reflect.Array:
+		n := fixedSize(t.Elem())
+		if n < 0 {
+			return -1
+		}
+		return n * t.Len()
+	}
+	return -1
+}
+
+type countingWriter struct {
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += len(p)
+	return len(p), nil
+}
+
+func (c *countingWriter) WriteString(s string) (int, error) {
+	c.n += len(s)
+	return len(s), nil
+}
+
 func Unmarshal(b []byte, v interface{}) error {
-	return NewDecoder(bytes.NewReader(b)).Decode(v)
+	return NewBytesDecoder(b).Decode(v)
+}
+
+// UnmarshalN is like Unmarshal but also returns the number of bytes of b
+// that were consumed, so that values can be decoded from a buffer one after
+// another.
+func UnmarshalN(b []byte, v interface{}) (int, error) {
+	dec := NewBytesDecoder(b)
+	err := dec.Decode(v)
+	return int(dec.r.n), err
+}
+
+// UnmarshalBigEndian is like Unmarshal but decodes fixed-size values in
+// big-endian byte order, regardless of DefaultEndian.
+func UnmarshalBigEndian(b []byte, v interface{}) error {
+	dec := NewBytesDecoder(b)
+	dec.Order = BigEndian
+	return dec.Decode(v)
+}
+
+// skipField reports whether a struct field is excluded from encoding, either
+// by being named "_" or by carrying a `binary:"-"` tag.
+func skipField(f reflect.StructField) bool {
+	return f.Name == "_" || f.Tag.Get("binary") == "-"
+}
+
+// tagFixed returns the length given by a fixed=N option in the `binary` tag
+// of f, -1 if N is not a positive integer, or zero if there is no such option.
+func tagFixed(f reflect.StructField) int {
+	for _, o := range strings.Split(f.Tag.Get("binary"), ",") {
+		if strings.HasPrefix(o, "fixed=") {
+			if n, err := strconv.Atoi(strings.TrimPrefix(o, "fixed=")); err == nil && n > 0 {
+				return n
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+// hasTag reports whether the comma-separated `binary` tag of f contains opt.
+func hasTag(f reflect.StructField, opt string) bool {
+	for _, o := range strings.Split(f.Tag.Get("binary"), ",") {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+	timeType            = reflect.TypeOf(time.Time{})
+	bytesType           = reflect.TypeOf([]byte(nil))
+	ipType              = reflect.TypeOf(net.IP(nil))
+	rawValueType        = reflect.TypeOf(RawValue(nil))
+	bufferType          = reflect.TypeOf(bytes.Buffer{})
+)
+
+// isByteType reports whether t is a uint8 type without methods or a codec,
+// so that arrays and slices of it can be read and written as a single block.
+func isByteType(t reflect.Type) bool {
+	if t.Kind() != reflect.Uint8 || reflect.PtrTo(t).NumMethod() != 0 {
+		return false
+	}
+	_, ok := lookupCodec(t)
+	return !ok
+}
+
+// field describes an encodable struct field.
+type field struct {
+	index    int
+	name     string
+	varint   bool
+	bitset   bool
+	unixnano bool
+	// asFloat32 is set for float64 fields written as 4-byte float32 values.
+	asFloat32 bool
+	// fixed is the length of a byte array or slice that is written without
+	// a length prefix, from a fixed=N tag, or zero if it has none.
+	fixed int
+	// inline is set for embedded structs of unexported type, whose
+	// exported fields are encoded in place as if promoted.
+	inline bool
+	// unexported fields are only encoded with IncludeUnexported set.
+	unexported bool
+	// tag is the field's index in a tagged struct, or zero if it has none.
+	tag int
+	// named is the field's name in a named struct, if it has a named or
+	// name=X tag, or empty if it has neither.
+	named string
+	// optional fields are omitted when they hold their zero value.
+	optional bool
+}
+
+// fieldCache maps struct types to their encodable fields.
+var fieldCache sync.Map // map[reflect.Type][]field
+
+// structFields returns the encodable fields of the struct type t, in
+// declaration order.
+func structFields(t reflect.Type) []field {
+	if fields, ok := fieldCache.Load(t); ok {
+		return fields.([]field)
+	}
+	fields := []field{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if skipField(f) {
+			continue
+		}
+		if !f.IsExported() && f.Anonymous && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, field{index: i, name: f.Name, inline: true})
+			continue
+		}
+		fields = append(fields, field{
+			index:      i,
+			name:       f.Name,
+			varint:     hasTag(f, "varint"),
+			bitset:     hasTag(f, "bitset"),
+			unixnano:   hasTag(f, "unixnano"),
+			asFloat32:  hasTag(f, "float32"),
+			fixed:      tagFixed(f),
+			unexported: !f.IsExported(),
+			tag:        tagIndex(f),
+			named:      tagName(f),
+			optional:   hasTag(f, "optional"),
+		})
+	}
+	cached, _ := fieldCache.LoadOrStore(t, fields)
+	return cached.([]field)
+}
+
+// exposeField returns a settable view of the addressable but possibly
+// unexported struct field v.
+func exposeField(v reflect.Value) reflect.Value {
+	return reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
 }
 
+// fieldValue returns the value of the field f of the addressable struct rv,
+// exposing it if it is unexported.
+func fieldValue(rv reflect.Value, f field) reflect.Value {
+	v := rv.Field(f.index)
+	if f.unexported {
+		v = exposeField(v)
+	}
+	return v
+}
+
+// LengthEncoding is the form in which length prefixes are written.
+type LengthEncoding int
+
+const (
+	// Varint writes lengths as unsigned varints. This is the default.
+	Varint LengthEncoding = iota
+	// Fixed32 writes lengths as 4-byte unsigned integers.
+	Fixed32
+	// Fixed64 writes lengths as 8-byte unsigned integers.
+	Fixed64
+)
+
+// ArrayLenPolicy selects how a Decoder with ArrayLengths set handles an array
+// whose encoded length differs from that of the array being decoded into.
+// Truncate and Pad may be combined to accept either kind of mismatch.
+type ArrayLenPolicy int
+
+const (
+	// ArrayLenError fails with an error on any mismatch. This is the default.
+	ArrayLenError ArrayLenPolicy = 0
+	// ArrayLenTruncate accepts a longer encoded array, discarding the
+	// elements that do not fit.
+	ArrayLenTruncate ArrayLenPolicy = 1
+	// ArrayLenPad accepts a shorter encoded array, setting the remaining
+	// elements to their zero value.
+	ArrayLenPad ArrayLenPolicy = 2
+)
+
 type Encoder struct {
-	Order  binary.ByteOrder
+	Order binary.ByteOrder
+	// SortKeys causes map keys to be encoded in ascending order, so that
+	// equal maps always produce identical output. Only maps keyed by
+	// booleans, integers, floats or strings can be sorted.
+	SortKeys bool
+	// PreserveNil encodes slice and map lengths offset by one, reserving
+	// zero for nil slices and maps so that they can be distinguished from
+	// empty ones. The decoder must have PreserveNil set to match.
+	PreserveNil bool
+	// IntSize is the width in bytes of encoded int and uint values, which may
+	// be 4 or 8. Zero selects 8. Values that do not fit in 4 bytes fail to
+	// encode. The decoder must have IntSize set to match.
+	IntSize int
+	// LengthEncoding selects how the length prefixes of strings, slices,
+	// maps and marshaled values are written. The decoder must have
+	// LengthEncoding set to match.
+	LengthEncoding LengthEncoding
+	// IncludeUnexported also encodes unexported struct fields, reading them
+	// through package unsafe. This bypasses the encapsulation of the types
+	// involved, whose unexported fields may change without notice, so it is
+	// best used only with types under your own control. The decoder must
+	// have IncludeUnexported set to match.
+	IncludeUnexported bool
+	// TrackRefs writes each distinct pointer only once per call to Encode,
+	// replacing later occurrences with a reference to the first. This
+	// preserves shared and cyclic pointers, which would otherwise be
+	// duplicated or recurse forever. Each field of a tagged or named struct
+	// is also followed by the number of pointers first written within it,
+	// so that a decoder that skips the field can still number those after
+	// it. The decoder must have TrackRefs set to match.
+	TrackRefs bool
+	// ArrayLengths writes a length prefix before each array, as for slices,
+	// so that a decoder can detect and tolerate a change in the length of an
+	// array type. The decoder must have ArrayLengths set to match.
+	ArrayLengths bool
+	// CanonicalNaN writes every NaN floating-point value, whatever its sign
+	// and payload, as the same quiet NaN bit pattern, so that equal values
+	// always produce identical output. Decoding is unaffected.
+	CanonicalNaN bool
+	// ExactFloat32 fails encoding of a float64 field tagged
+	// `binary:"float32"` whose value cannot be represented exactly as a
+	// float32, rather than rounding it to the nearest float32. NaNs are
+	// always accepted. Decoding is unaffected.
+	ExactFloat32 bool
+	// UTC converts each time.Time to UTC before encoding it. A time is
+	// otherwise encoded with its zone offset but not its named location, so
+	// it decodes with a fixed offset, or as local time if the offset matches
+	// the local zone. Normalizing to UTC preserves the instant and makes all
+	// decoded times comparable with ==. Decoding is unaffected.
+	UTC    bool
 	w      io.Writer
 	buf    []byte
 	strict bool
+	refs   map[ref]int
+	bw     *bufio.Writer
+	fw     *flate.Writer
+	chunk  []byte
 }
 
+// NewEncoder creates an encoder that writes directly to w, which may be any
+// io.Writer. Nothing is buffered, so encoding to a hash.Hash, for example,
+// computes a digest of the encoding without holding it in memory. Use
+// NewBufferedEncoder for writers whose Write calls are costly.
 func NewEncoder(w io.Writer) *Encoder {
 	return &Encoder{
 		Order: DefaultEndian,
 		w:     w,
-		buf:   make([]byte, 8),
+		buf:   make([]byte, 16),
 	}
 }
 
@@ -53,244 +461,1703 @@ func NewStrictEncoder(w io.Writer) *Encoder {
 	return e
 }
 
+// NewBufferedEncoder creates an encoder similar to NewEncoder that buffers
+// its output, writing to w only when the buffer fills or Flush is called.
+func NewBufferedEncoder(w io.Writer) *Encoder {
+	bw := bufio.NewWriter(w)
+	e := NewEncoder(bw)
+	e.bw = bw
+	return e
+}
+
+// Flush writes any buffered output to the underlying writer. It does
+// nothing for encoders not created by NewBufferedEncoder or
+// NewCompressingEncoder.
+func (e *Encoder) Flush() error {
+	if e.fw != nil {
+		return e.fw.Flush()
+	}
+	if e.bw == nil {
+		return nil
+	}
+	return e.bw.Flush()
+}
+
+// Reset discards the encoder's writer and directs further output to w,
+// retaining the encoder's configuration and scratch buffer. Any unflushed
+// output of a buffered or compressing encoder is discarded.
+func (e *Encoder) Reset(w io.Writer) {
+	if e.fw != nil {
+		e.fw.Reset(w)
+		return
+	}
+	if e.bw != nil {
+		e.bw.Reset(w)
+		return
+	}
+	e.w = w
+}
+
+// SetEndian sets the byte order used for fixed-size values written by this
+// encoder. A nil order resets it to DefaultEndian.
+func (e *Encoder) SetEndian(order binary.ByteOrder) {
+	if order == nil {
+		order = DefaultEndian
+	}
+	e.Order = order
+}
+
 func (e *Encoder) writeVarint(v int) error {
 	l := binary.PutUvarint(e.buf, uint64(v))
 	_, err := e.w.Write(e.buf[:l])
 	return err
 }
 
-func (b *Encoder) Encode(v interface{}) (err error) {
-	switch cv := v.(type) {
-	case encoding.BinaryMarshaler:
-		buf, err := cv.MarshalBinary()
-		if err != nil {
-			return err
-		}
-		if err = b.writeVarint(len(buf)); err != nil {
-			return err
-		}
-		_, err = b.w.Write(buf)
-
-	case []byte: // fast-path byte arrays
-		if err = b.writeVarint(len(cv)); err != nil {
-			return
+// writeLen writes a length prefix in the form selected by LengthEncoding.
+func (e *Encoder) writeLen(l int) error {
+	switch e.LengthEncoding {
+	case Varint:
+		return e.writeVarint(l)
+	case Fixed32:
+		if uint64(l) > math.MaxUint32 {
+			return fmt.Errorf("binary: length %d overflows Fixed32", l)
 		}
-		_, err = b.w.Write(cv)
-
-	default:
-		rv := reflect.Indirect(reflect.ValueOf(v))
-		t := rv.Type()
-		switch t.Kind() {
-		case reflect.Array:
-			l := t.Len()
-			for i := 0; i < l; i++ {
-				if err = b.Encode(rv.Index(i).Addr().Interface()); err != nil {
-					return
-				}
-			}
-
-		case reflect.Slice:
-			l := rv.Len()
-			if err = b.writeVarint(l); err != nil {
-				return
-			}
-			for i := 0; i < l; i++ {
-				if err = b.Encode(rv.Index(i).Addr().Interface()); err != nil {
-					return
-				}
-			}
+		e.Order.PutUint32(e.buf, uint32(l))
+		_, err := e.w.Write(e.buf[:4])
+		return err
+	case Fixed64:
+		e.Order.PutUint64(e.buf, uint64(l))
+		_, err := e.w.Write(e.buf[:8])
+		return err
+	}
+	return fmt.Errorf("binary: invalid LengthEncoding %d", e.LengthEncoding)
+}
 
-		case reflect.Struct:
-			l := rv.NumField()
-			n := 0
-			for i := 0; i < l; i++ {
-				if v := rv.Field(i); t.Field(i).Name != "_" && t.Field(i).IsExported() {
-					if err = b.Encode(v.Interface()); err != nil {
-						return
-					}
-					n++
-				}
-			}
-			if b.strict && n == 0 {
-				return fmt.Errorf("binary: struct had no encodable fields")
-			}
+// writeSvarint writes v as a zigzag encoded varint, so that small negative
+// values are as compact as small positive ones.
+func (e *Encoder) writeSvarint(v int64) error {
+	l := binary.PutVarint(e.buf, v)
+	_, err := e.w.Write(e.buf[:l])
+	return err
+}
 
-		case reflect.Map:
-			l := rv.Len()
-			if err = b.writeVarint(l); err != nil {
-				return
-			}
-			for _, key := range rv.MapKeys() {
-				value := rv.MapIndex(key)
-				if err = b.Encode(key.Interface()); err != nil {
-					return err
-				}
-				if err = b.Encode(value.Interface()); err != nil {
-					return err
-				}
-			}
+// writeSliceLen writes the length prefix of a slice or map, taking
+// PreserveNil into account.
+func (e *Encoder) writeSliceLen(isNil bool, l int) error {
+	if !e.PreserveNil {
+		return e.writeLen(l)
+	}
+	if isNil {
+		return e.writeLen(0)
+	}
+	return e.writeLen(l + 1)
+}
 
-		case reflect.String:
-			if err = b.writeVarint(rv.Len()); err != nil {
-				return
-			}
-			_, err = b.w.Write([]byte(rv.String()))
+// Encode writes the encoding of v. Struct fields are written in declaration
+// order, omitting unexported fields and those tagged `binary:"-"`. Embedded
+// structs are encoded like any other field, except that the exported fields
+// of an embedded struct of unexported type are encoded in its place as if
+// promoted. Embedded pointers are written with a presence byte as for other
+// pointer fields, and embedded interfaces, as for all interface values,
+// require their dynamic types to be registered with Register.
+//
+// Struct tags select alternative encodings for some fields: `binary:"varint"`
+// for integers, `binary:"bitset"` for []bool, `binary:"unixnano"` for
+// time.Time and `binary:"float32"` for float64. A unixnano time is written as
+// a fixed 8-byte count of nanoseconds since the Unix epoch, so it must fall
+// between the years 1678 and 2262. Its location and monotonic clock reading
+// are not preserved, and it decodes in the local time zone. A float32 field
+// is written in 4 bytes, rounded to the nearest float32 unless ExactFloat32
+// is set.
+//
+// A byte slice or array field tagged `binary:"fixed=N"` is written as exactly
+// N bytes with no length prefix, for formats in which the length is implied,
+// such as that of a hash. A slice must hold exactly N bytes, and an array
+// must have length N.
+//
+// A struct in which any field has a positive integer tag, such as
+// `binary:"3"` or `binary:"3,varint"`, is encoded in tagged form: each of its
+// fields must carry a distinct index, and is written as its index and a
+// length-prefixed value, preceded by the number of fields. Decoding matches
+// fields by index rather than position, leaving any that are missing zero and
+// skipping unknown indices, so that fields can be added, removed and
+// reordered without breaking existing data.
+//
+// A struct in which any field is tagged `binary:"named"` or `binary:"name=X"`
+// is encoded in named form, like a tagged struct but with each field written
+// under its name rather than an index: X for a field tagged name=X, and the
+// field's own name otherwise. This is larger than the tagged form but makes
+// the encoding self-describing and allows fields to be renamed in Go while
+// keeping their encoded name.
+//
+// A field tagged `binary:"optional"` is omitted when it holds its zero value.
+// Each struct with optional fields begins with a bitmap recording which of
+// them are present, one bit per optional field, least significant bit first.
+// Absent fields decode as zero. In tagged and named structs, absent fields are
+// simply not written, and no bitmap is needed.
+//
+// A panic during encoding, such as from a MarshalBinary method, is recovered
+// and returned as an error.
+func (b *Encoder) Encode(v interface{}) error {
+	return b.EncodeValue(reflect.ValueOf(v))
+}
 
-		case reflect.Bool:
-			var out byte
-			if rv.Bool() {
-				out = 1
-			}
-			err = binary.Write(b.w, b.Order, out)
+// EncodeValue is like Encode but takes a reflect.Value. As with Encode, a
+// pointer is dereferenced and the value it points to is encoded.
+func (b *Encoder) EncodeValue(rv reflect.Value) (err error) {
+	defer recoverPanic(&err)
+	if !rv.IsValid() {
+		return errors.New("binary: cannot encode nil value")
+	}
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return errors.New("binary: cannot encode nil pointer of type " + rv.Type().String())
+	}
+	if b.TrackRefs && b.refs == nil {
+		b.refs = map[ref]int{}
+		defer func() { b.refs = nil }()
+		b.trackRoot(rv)
+	}
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	return b.encodeValue(rv)
+}
 
-		case reflect.Int:
-			err = binary.Write(b.w, b.Order, int64(rv.Int()))
+// Flags recording which interfaces a type or a pointer to it implements.
+const (
+	valueMarshaler = 1 << iota
+	pointerMarshaler
+	preMarshalHook
+	postUnmarshalHook
+	validateHook
+)
 
-		case reflect.Uint:
-			err = binary.Write(b.w, b.Order, int64(rv.Uint()))
+// implementsMarshaler reports whether t implements BinaryMarshaler or
+// TextMarshaler.
+func implementsMarshaler(t reflect.Type) bool {
+	return t.Implements(binaryMarshalerType) || t.Implements(textMarshalerType)
+}
 
-		case reflect.Int8, reflect.Uint8, reflect.Int16, reflect.Uint16,
-			reflect.Int32, reflect.Uint32, reflect.Int64, reflect.Uint64,
-			reflect.Float32, reflect.Float64,
-			reflect.Complex64, reflect.Complex128:
-			err = binary.Write(b.w, b.Order, v)
+// typeFlagCache maps types to a combination of the flags above.
+var typeFlagCache sync.Map // map[reflect.Type]int
 
-		default:
-			return errors.New("binary: unsupported type " + t.String())
+// typeFlags returns the flags for t, which are always zero for interfaces.
+func typeFlags(t reflect.Type) int {
+	if flags, ok := typeFlagCache.Load(t); ok {
+		return flags.(int)
+	}
+	f := 0
+	if t.Kind() != reflect.Interface {
+		pt := reflect.PtrTo(t)
+		if implementsMarshaler(t) {
+			f |= valueMarshaler
+		}
+		if implementsMarshaler(pt) {
+			f |= pointerMarshaler
+		}
+		if pt.Implements(preMarshalerType) {
+			f |= preMarshalHook
+		}
+		if pt.Implements(postUnmarshalerType) {
+			f |= postUnmarshalHook
+		}
+		if t.Kind() == reflect.Struct && pt.Implements(validatorType) {
+			f |= validateHook
 		}
 	}
-	return
-}
-
-type byteReader struct {
-	io.Reader
+	flags, _ := typeFlagCache.LoadOrStore(t, f)
+	return flags.(int)
 }
 
-func (b *byteReader) ReadByte() (byte, error) {
-	var buf [1]byte
-	if _, err := io.ReadFull(b, buf[:]); err != nil {
-		return 0, err
+// marshaler returns the BinaryMarshaler or TextMarshaler implemented by rv
+// or by its address, as recorded in the type flags of rv, copying rv if it
+// is not addressable.
+func marshaler(rv reflect.Value, flags int) interface{} {
+	switch {
+	case flags&valueMarshaler != 0:
+		return rv.Interface()
+	case flags&pointerMarshaler != 0:
+		return addressable(rv).Addr().Interface()
 	}
-	return buf[0], nil
+	return nil
 }
 
-type Decoder struct {
-	Order binary.ByteOrder
-	r     *byteReader
+// addressable returns rv if it is addressable, or otherwise an addressable
+// copy of it, for values such as map elements that cannot be addressed.
+func addressable(rv reflect.Value) reflect.Value {
+	if rv.CanAddr() {
+		return rv
+	}
+	cp := reflect.New(rv.Type()).Elem()
+	cp.Set(rv)
+	return cp
 }
 
-func NewDecoder(r io.Reader) *Decoder {
-	return &Decoder{
-		Order: DefaultEndian,
-		r:     &byteReader{r},
+func (b *Encoder) encodeValue(rv reflect.Value) (err error) {
+	t := rv.Type()
+	if c, ok := lookupCodec(t); ok {
+		return c.enc(b, rv)
 	}
-}
+	if t.Kind() == reflect.Ptr {
+		// Pointers held in slices, arrays and maps. Those in struct fields
+		// are handled by encodeFields.
+		return b.encodePtr(rv)
+	}
+	switch t {
+	// Single bytes skip the checks below, which cannot apply to them.
+	case uint8Type, int8Type:
+		return b.encodeFixed(rv)
 
-func (d *Decoder) Decode(v interface{}) (err error) {
-	// Check if the type implements the encoding.BinaryUnmarshaler interface, and use it if so.
-	if i, ok := v.(encoding.BinaryUnmarshaler); ok {
-		var l uint64
-		if l, err = binary.ReadUvarint(d.r); err != nil {
+	// time.Duration is always encoded as a fixed 8-byte nanosecond count.
+	case durationType:
+		return b.encodeFixed(rv)
+
+	// net.IP is encoded as raw bytes rather than through its TextMarshaler,
+	// and RawValue is always written verbatim.
+	case bytesType, ipType, rawValueType: // fast-path byte arrays
+		if err = b.writeSliceLen(rv.IsNil(), rv.Len()); err != nil {
+			return
+		}
+		_, err = b.w.Write(rv.Bytes())
+		return
+
+	case blobType:
+		return b.encodeBlob(rv)
+
+	// bytes.Buffer is encoded as its unread bytes, with a length prefix.
+	case bufferType:
+		buf := addressable(rv).Addr().Interface().(*bytes.Buffer)
+		if err = b.writeLen(buf.Len()); err != nil {
+			return
+		}
+		_, err = b.w.Write(buf.Bytes())
+		return
+
+	case syncMapType:
+		return b.encodeSyncMap(rv)
+	}
+	if nullTypes[t] {
+		return b.encodeNull(rv)
+	}
+	flags := typeFlags(t)
+	if flags&preMarshalHook != 0 {
+		if rv, err = preMarshal(rv); err != nil {
 			return
 		}
-		buf := make([]byte, l)
-		_, err = d.r.Read(buf)
-		return i.UnmarshalBinary(buf)
 	}
 
-	// Otherwise, use reflection.
-	rv := reflect.Indirect(reflect.ValueOf(v))
-	if !rv.CanAddr() {
-		return errors.New("binary: can only Decode to pointer type")
+	if t == timeType && b.UTC {
+		rv = reflect.ValueOf(rv.Interface().(time.Time).UTC())
+	}
+	if m := marshaler(rv, flags); m != nil {
+		var buf []byte
+		switch m := m.(type) {
+		// big.Float has no binary form, and its text form is rounded to a
+		// decimal, so use its gob form, which keeps the full precision.
+		case *big.Float:
+			buf, err = m.GobEncode()
+		case encoding.BinaryMarshaler:
+			buf, err = m.MarshalBinary()
+		case encoding.TextMarshaler:
+			buf, err = m.MarshalText()
+		}
+		if err != nil {
+			return
+		}
+		if err = b.writeLen(len(buf)); err != nil {
+			return
+		}
+		_, err = b.w.Write(buf)
+		return
 	}
-	t := rv.Type()
 
 	switch t.Kind() {
 	case reflect.Array:
-		len := t.Len()
-		for i := 0; i < int(len); i++ {
-			if err = d.Decode(rv.Index(i).Addr().Interface()); err != nil {
+		l := t.Len()
+		if b.ArrayLengths {
+			if err = b.writeLen(l); err != nil {
 				return
 			}
 		}
+		if isByteType(t.Elem()) {
+			_, err = b.w.Write(addressable(rv).Slice(0, l).Bytes())
+			return
+		}
+		for i := 0; i < l; i++ {
+			if err = b.encodeValue(rv.Index(i)); err != nil {
+				return withIndex(err, i)
+			}
+		}
 
 	case reflect.Slice:
-		var l uint64
-		if l, err = binary.ReadUvarint(d.r); err != nil {
+		l := rv.Len()
+		if err = b.writeSliceLen(rv.IsNil(), l); err != nil {
+			return
+		}
+		if isByteType(t.Elem()) {
+			_, err = b.w.Write(rv.Bytes())
 			return
 		}
-		if t.Kind() == reflect.Slice {
-			rv.Set(reflect.MakeSlice(t, int(l), int(l)))
-		} else if int(l) != t.Len() {
-			return fmt.Errorf("binary: encoded size %d != real size %d", l, t.Len())
+		if ok, err := b.encodeFastSlice(rv); ok {
+			return err
 		}
-		for i := 0; i < int(l); i++ {
-			if err = d.Decode(rv.Index(i).Addr().Interface()); err != nil {
-				return
+		for i := 0; i < l; i++ {
+			if err = b.encodeValue(rv.Index(i)); err != nil {
+				return withIndex(err, i)
 			}
 		}
 
 	case reflect.Struct:
-		l := rv.NumField()
-		for i := 0; i < l; i++ {
-			if v := rv.Field(i); v.CanSet() && t.Field(i).Name != "_" {
-				if err = d.Decode(v.Addr().Interface()); err != nil {
-					return
-				}
-			}
+		// Copy the struct if need be so that its fields are addressable and
+		// pointer receiver marshalers can be found.
+		if err = b.encodeFields(addressable(rv)); err != nil {
+			return
+		}
+		if b.strict && !b.hasFields(t) {
+			return fmt.Errorf("binary: struct had no encodable fields")
 		}
 
 	case reflect.Map:
-		var l uint64
-		if l, err = binary.ReadUvarint(d.r); err != nil {
+		l := rv.Len()
+		if err = b.writeSliceLen(rv.IsNil(), l); err != nil {
 			return
 		}
-		kt := t.Key()
-		vt := t.Elem()
-		rv.Set(reflect.MakeMap(t))
-		for i := 0; i < int(l); i++ {
-			kv := reflect.Indirect(reflect.New(kt))
-			if err = d.Decode(kv.Addr().Interface()); err != nil {
+		keys := rv.MapKeys()
+		if b.SortKeys {
+			if err = sortKeys(keys); err != nil {
 				return
 			}
-			vv := reflect.Indirect(reflect.New(vt))
-			if err = d.Decode(vv.Addr().Interface()); err != nil {
-				return
+		}
+		for _, key := range keys {
+			value := rv.MapIndex(key)
+			if err = b.encodeValue(key); err != nil {
+				return withKey(err, key)
+			}
+			if err = b.encodeValue(value); err != nil {
+				return withKey(err, key)
 			}
-			rv.SetMapIndex(kv, vv)
 		}
 
+	case reflect.Interface:
+		err = b.encodeInterface(rv)
+
 	case reflect.String:
-		var l uint64
-		if l, err = binary.ReadUvarint(d.r); err != nil {
+		if err = b.writeLen(rv.Len()); err != nil {
 			return
 		}
-		buf := make([]byte, l)
-		_, err = d.r.Read(buf)
-		rv.SetString(string(buf))
-
-	case reflect.Bool:
-		var out byte
-		err = binary.Read(d.r, d.Order, &out)
-		rv.SetBool(out != 0)
+		_, err = io.WriteString(b.w, rv.String())
 
-	case reflect.Int:
-		var out int64
-		err = binary.Read(d.r, d.Order, &out)
-		rv.SetInt(out)
-
-	case reflect.Uint:
-		var out uint64
-		err = binary.Read(d.r, d.Order, &out)
-		rv.SetUint(out)
-
-	case reflect.Int8, reflect.Uint8, reflect.Int16, reflect.Uint16,
+	case reflect.Bool, reflect.Int, reflect.Uint, reflect.Uintptr,
+		reflect.Int8, reflect.Uint8, reflect.Int16, reflect.Uint16,
 		reflect.Int32, reflect.Uint32, reflect.Int64, reflect.Uint64,
 		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
-		err = binary.Read(d.r, d.Order, v)
+		err = b.encodeFixed(rv)
 
 	default:
 		return errors.New("binary: unsupported type " + t.String())
 	}
 	return
 }
+
+// encodeFixed writes the fixed-size boolean or numeric value rv, as read by
+// Decoder.decodeFixed.
+func (b *Encoder) encodeFixed(rv reflect.Value) error {
+	buf := b.buf
+	n := 8
+	switch rv.Kind() {
+	case reflect.Bool:
+		buf[0] = 0
+		if rv.Bool() {
+			buf[0] = 1
+		}
+		n = 1
+	case reflect.Int8:
+		buf[0] = byte(rv.Int())
+		n = 1
+	case reflect.Uint8:
+		buf[0] = byte(rv.Uint())
+		n = 1
+	case reflect.Int16:
+		b.Order.PutUint16(buf, uint16(rv.Int()))
+		n = 2
+	case reflect.Uint16:
+		b.Order.PutUint16(buf, uint16(rv.Uint()))
+		n = 2
+	case reflect.Int32:
+		b.Order.PutUint32(buf, uint32(rv.Int()))
+		n = 4
+	case reflect.Uint32:
+		b.Order.PutUint32(buf, uint32(rv.Uint()))
+		n = 4
+	case reflect.Int:
+		var err error
+		if n, err = intSize(b.IntSize); err != nil {
+			return err
+		}
+		x := rv.Int()
+		if n == 8 {
+			b.Order.PutUint64(buf, uint64(x))
+		} else if x != int64(int32(x)) {
+			return fmt.Errorf("binary: int %d overflows IntSize %d", x, n)
+		} else {
+			b.Order.PutUint32(buf, uint32(x))
+		}
+	case reflect.Uint:
+		var err error
+		if n, err = intSize(b.IntSize); err != nil {
+			return err
+		}
+		x := rv.Uint()
+		if n == 8 {
+			b.Order.PutUint64(buf, x)
+		} else if x != uint64(uint32(x)) {
+			return fmt.Errorf("binary: uint %d overflows IntSize %d", x, n)
+		} else {
+			b.Order.PutUint32(buf, uint32(x))
+		}
+	case reflect.Int64:
+		b.Order.PutUint64(buf, uint64(rv.Int()))
+	case reflect.Uint64, reflect.Uintptr:
+		b.Order.PutUint64(buf, rv.Uint())
+	case reflect.Float32:
+		b.Order.PutUint32(buf, b.float32bits(float32(rv.Float())))
+		n = 4
+	case reflect.Float64:
+		b.Order.PutUint64(buf, b.float64bits(rv.Float()))
+	case reflect.Complex64:
+		c := rv.Complex()
+		b.Order.PutUint32(buf, b.float32bits(float32(real(c))))
+		b.Order.PutUint32(buf[4:], b.float32bits(float32(imag(c))))
+	case reflect.Complex128:
+		c := rv.Complex()
+		b.Order.PutUint64(buf, b.float64bits(real(c)))
+		b.Order.PutUint64(buf[8:], b.float64bits(imag(c)))
+		n = 16
+	}
+	_, err := b.w.Write(buf[:n])
+	return err
+}
+
+// Canonical quiet NaN bit patterns written when CanonicalNaN is set.
+const (
+	canonicalNaN32 = 0x7fc00000
+	canonicalNaN64 = 0x7ff8000000000000
+)
+
+// float32bits returns the bits of f to encode, honouring CanonicalNaN.
+func (b *Encoder) float32bits(f float32) uint32 {
+	if b.CanonicalNaN && math.IsNaN(float64(f)) {
+		return canonicalNaN32
+	}
+	return math.Float32bits(f)
+}
+
+// float64bits returns the bits of f to encode, honouring CanonicalNaN.
+func (b *Encoder) float64bits(f float64) uint64 {
+	if b.CanonicalNaN && math.IsNaN(f) {
+		return canonicalNaN64
+	}
+	return math.Float64bits(f)
+}
+
+// hasFields reports whether the struct type t has any fields to encode.
+func (b *Encoder) hasFields(t reflect.Type) bool {
+	for _, f := range structFields(t) {
+		if !f.unexported || b.IncludeUnexported {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeFields encodes the fields of the addressable struct rv in order.
+func (b *Encoder) encodeFields(rv reflect.Value) error {
+	fields := structFields(rv.Type())
+	if isTagged(fields) {
+		return b.encodeTaggedFields(rv, fields)
+	}
+	if isNamed(fields) {
+		return b.encodeNamedFields(rv, fields)
+	}
+	present, err := b.writePresence(rv, fields)
+	if err != nil {
+		return err
+	}
+	k := 0
+	for _, f := range fields {
+		if f.unexported && !b.IncludeUnexported {
+			continue
+		}
+		if f.optional {
+			k++
+			if !isPresent(present, k-1) {
+				continue
+			}
+		}
+		if err := b.encodeField(f, fieldValue(rv, f)); err != nil {
+			if f.inline {
+				return err
+			}
+			return withField(err, f.name)
+		}
+	}
+	return nil
+}
+
+// encodeField encodes the value v of the struct field f.
+func (b *Encoder) encodeField(f field, v reflect.Value) error {
+	switch {
+	case f.inline:
+		return b.encodeFields(v)
+	case f.varint:
+		return b.encodeVarint(v)
+	case f.bitset:
+		return b.encodeBitset(v)
+	case f.unixnano:
+		return b.encodeUnixNano(v)
+	case f.asFloat32:
+		return b.encodeAsFloat32(v)
+	case f.fixed != 0:
+		return b.encodeFixedBytes(v, f.fixed)
+	case v.Kind() == reflect.Ptr:
+		return b.encodePtr(v)
+	default:
+		return b.encodeValue(v)
+	}
+}
+
+// encodePtr writes a presence byte for the pointer rv, followed by the
+// pointed-to value if rv is non-nil, unless a codec is registered for the
+// pointer type.
+func (b *Encoder) encodePtr(rv reflect.Value) error {
+	if c, ok := lookupCodec(rv.Type()); ok {
+		return c.enc(b, rv)
+	}
+	if b.TrackRefs {
+		return b.encodeRef(rv)
+	}
+	if rv.IsNil() {
+		_, err := b.w.Write([]byte{0})
+		return err
+	}
+	if _, err := b.w.Write([]byte{1}); err != nil {
+		return err
+	}
+	if rv.Elem().Kind() == reflect.Ptr {
+		return b.encodePtr(rv.Elem())
+	}
+	return b.encodeValue(rv.Elem())
+}
+
+// sortKeys sorts map keys in ascending order.
+func sortKeys(keys []reflect.Value) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	var less func(a, b reflect.Value) bool
+	switch keys[0].Kind() {
+	case reflect.Bool:
+		less = func(a, b reflect.Value) bool { return !a.Bool() && b.Bool() }
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		less = func(a, b reflect.Value) bool { return a.Int() < b.Int() }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		less = func(a, b reflect.Value) bool { return a.Uint() < b.Uint() }
+	case reflect.Float32, reflect.Float64:
+		less = func(a, b reflect.Value) bool { return a.Float() < b.Float() }
+	case reflect.String:
+		less = func(a, b reflect.Value) bool { return a.String() < b.String() }
+	default:
+		return errors.New("binary: cannot sort map keys of type " + keys[0].Type().String())
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+	return nil
+}
+
+// encodeVarint writes the integer rv as a varint, zigzag encoded if signed.
+func (b *Encoder) encodeVarint(rv reflect.Value) error {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return b.writeSvarint(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		l := binary.PutUvarint(b.buf, rv.Uint())
+		_, err := b.w.Write(b.buf[:l])
+		return err
+	default:
+		return errors.New("binary: varint tag on non-integer type " + rv.Type().String())
+	}
+}
+
+// encodeBitset writes the bool slice rv as its length followed by its
+// elements packed eight to a byte, least significant bit first.
+func (b *Encoder) encodeBitset(rv reflect.Value) error {
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() != reflect.Bool {
+		return errors.New("binary: bitset tag on non-[]bool type " + rv.Type().String())
+	}
+	l := rv.Len()
+	if err := b.writeSliceLen(rv.IsNil(), l); err != nil {
+		return err
+	}
+	packed := make([]byte, (l+7)/8)
+	for i := 0; i < l; i++ {
+		if rv.Index(i).Bool() {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	_, err := b.w.Write(packed)
+	return err
+}
+
+// encodeUnixNano writes the time.Time rv as a fixed 8-byte count of
+// nanoseconds since the Unix epoch.
+func (b *Encoder) encodeUnixNano(rv reflect.Value) error {
+	if rv.Type() != timeType {
+		return errors.New("binary: unixnano tag on non-time.Time type " + rv.Type().String())
+	}
+	b.Order.PutUint64(b.buf, uint64(rv.Interface().(time.Time).UnixNano()))
+	_, err := b.w.Write(b.buf[:8])
+	return err
+}
+
+// encodeAsFloat32 writes the float64 rv as a 4-byte float32.
+func (b *Encoder) encodeAsFloat32(rv reflect.Value) error {
+	if rv.Kind() != reflect.Float64 {
+		return errors.New("binary: float32 tag on non-float64 type " + rv.Type().String())
+	}
+	x := rv.Float()
+	if b.ExactFloat32 && float64(float32(x)) != x && !math.IsNaN(x) {
+		return fmt.Errorf("binary: %v cannot be represented exactly as a float32", x)
+	}
+	b.Order.PutUint32(b.buf, b.float32bits(float32(x)))
+	_, err := b.w.Write(b.buf[:4])
+	return err
+}
+
+// checkFixed checks that a fixed=n tag may be applied to a field of type t,
+// which must be a byte slice or a byte array of length n.
+func checkFixed(t reflect.Type, n int) error {
+	if n < 0 {
+		return errors.New("binary: fixed tag without a positive length")
+	}
+	switch {
+	case t.Kind() == reflect.Slice && isByteType(t.Elem()):
+	case t.Kind() == reflect.Array && isByteType(t.Elem()):
+		if t.Len() != n {
+			return fmt.Errorf("binary: fixed=%d tag on %s", n, t)
+		}
+	default:
+		return errors.New("binary: fixed tag on non-byte array or slice type " + t.String())
+	}
+	return nil
+}
+
+// encodeFixedBytes writes the n bytes of the byte array or slice rv, without
+// a length prefix. A slice must hold exactly n bytes.
+func (b *Encoder) encodeFixedBytes(rv reflect.Value, n int) error {
+	if err := checkFixed(rv.Type(), n); err != nil {
+		return err
+	}
+	if rv.Kind() == reflect.Array {
+		rv = addressable(rv).Slice(0, n)
+	} else if rv.Len() != n {
+		return fmt.Errorf("binary: %d bytes do not match fixed=%d tag", rv.Len(), n)
+	}
+	_, err := b.w.Write(rv.Bytes())
+	return err
+}
+
+type byteReader struct {
+	io.Reader
+	n     int64 // total bytes read
+	limit int64 // value of n at which to stop reading, if positive
+	buf   [1]byte
+}
+
+var errMaxBytes = errors.New("binary: value exceeds MaxBytes")
+
+func (b *byteReader) Read(p []byte) (int, error) {
+	if b.limit > 0 {
+		if b.n >= b.limit {
+			return 0, errMaxBytes
+		}
+		if rem := b.limit - b.n; int64(len(p)) > rem {
+			p = p[:rem]
+		}
+	}
+	n, err := b.Reader.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *byteReader) ReadByte() (byte, error) {
+	if _, err := io.ReadFull(b, b.buf[:]); err != nil {
+		return 0, err
+	}
+	return b.buf[0], nil
+}
+
+// Validator may be implemented by a struct type, or a pointer to one, to
+// check its fields once they have been decoded. An error returned by Validate
+// fails the decode.
+type Validator interface {
+	Validate() error
+}
+
+type Decoder struct {
+	Order binary.ByteOrder
+	// MaxLen is the largest length prefix the decoder will accept for a
+	// string, slice or map. Longer values are rejected with an error before
+	// anything is allocated for them. Zero or less disables the check.
+	MaxLen int
+	// MaxDepth is the deepest nesting of values the decoder will descend
+	// into before failing with an error. Zero or less disables the check.
+	MaxDepth int
+	// MaxBytes is the most input a single call to Decode or Skip will read
+	// before failing with an error. Zero or less disables the check.
+	MaxBytes int
+	// PreserveNil must match the Encoder setting of the same name.
+	PreserveNil bool
+	// IntSize must match the Encoder setting of the same name.
+	IntSize int
+	// LengthEncoding must match the Encoder setting of the same name.
+	LengthEncoding LengthEncoding
+	// IncludeUnexported must match the Encoder setting of the same name. It
+	// allows decoding to set unexported struct fields through package unsafe.
+	IncludeUnexported bool
+	// MergeMaps adds decoded entries to a map that is already present in the
+	// destination, rather than replacing it with a new map.
+	MergeMaps bool
+	// AllowShortStruct accepts input that ends between two fields of a
+	// struct, leaving the remaining fields zero, so that data written before
+	// fields were appended to a struct can still be read. Input ending part
+	// way through a field is still an error. As the decoder cannot otherwise
+	// tell where a value ends, this only helps with the last value in the
+	// input.
+	AllowShortStruct bool
+	// TrackRefs must match the Encoder setting of the same name.
+	TrackRefs bool
+	// ArrayLengths must match the Encoder setting of the same name.
+	ArrayLengths bool
+	// ArrayLenMismatch selects how arrays whose encoded length differs from
+	// the destination are handled when ArrayLengths is set.
+	ArrayLenMismatch ArrayLenPolicy
+	r                *byteReader
+	zeroCopy         bool
+	validateUTF8     bool
+	depth            int
+	buf              [16]byte
+	chunk            []byte
+	refs             []reflect.Value
+	fr               io.ReadCloser
+	sliceHint        int
+}
+
+// NewDecoder creates a decoder reading from r. The decoder does not buffer
+// its input and never reads past the end of the value being decoded, so r
+// may be read directly between calls to Decode without losing data.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		Order:    DefaultEndian,
+		MaxLen:   DefaultMaxLen,
+		MaxDepth: DefaultMaxDepth,
+		r:        &byteReader{Reader: r},
+	}
+}
+
+// NewBytesDecoder returns a decoder that reads from b. It behaves like a
+// decoder reading from bytes.NewReader(b), except that with SetZeroCopy
+// decoded strings can alias b.
+func NewBytesDecoder(b []byte) *Decoder {
+	return NewDecoder(&sliceReader{b: b})
+}
+
+// readLen reads a length prefix, checking it against MaxLen.
+func (d *Decoder) readLen() (int, error) {
+	l, err := d.readLenPrefix()
+	if err != nil {
+		return 0, err
+	}
+	return d.checkLen(l)
+}
+
+// readLenPrefix reads a length prefix as written by Encoder.writeLen,
+// without checking it.
+func (d *Decoder) readLenPrefix() (uint64, error) {
+	switch d.LengthEncoding {
+	case Varint:
+		return binary.ReadUvarint(d.r)
+	case Fixed32:
+		buf, err := d.readFixed(4)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(d.Order.Uint32(buf)), nil
+	case Fixed64:
+		buf, err := d.readFixed(8)
+		if err != nil {
+			return 0, err
+		}
+		return d.Order.Uint64(buf), nil
+	}
+	return 0, fmt.Errorf("binary: invalid LengthEncoding %d", d.LengthEncoding)
+}
+
+// readSvarint reads a zigzag encoded varint, as written by
+// Encoder.writeSvarint.
+func (d *Decoder) readSvarint() (int64, error) {
+	return binary.ReadVarint(d.r)
+}
+
+// readBytes reads a length-prefixed byte slice.
+func (d *Decoder) readBytes() ([]byte, error) {
+	l, err := d.readLen()
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, l)
+	if _, err = io.ReadFull(d.r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// nexter is implemented by readers, such as *bytes.Buffer, that can return
+// the next n bytes of their buffer without copying.
+type nexter interface {
+	Next(n int) []byte
+}
+
+// sliceReader reads from a byte slice. Unlike bytes.Reader, it exposes the
+// slice through Next, for zero-copy decoding.
+type sliceReader struct {
+	b []byte
+}
+
+func (r *sliceReader) Read(p []byte) (int, error) {
+	if len(r.b) == 0 && len(p) > 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.b)
+	r.b = r.b[n:]
+	return n, nil
+}
+
+func (r *sliceReader) Next(n int) []byte {
+	if n > len(r.b) {
+		n = len(r.b)
+	}
+	buf := r.b[:n:n]
+	r.b = r.b[n:]
+	return buf
+}
+
+// readString reads a length-prefixed string.
+func (d *Decoder) readString() (string, error) {
+	l, err := d.readLen()
+	if err != nil {
+		return "", err
+	}
+	if nx, ok := d.r.Reader.(nexter); ok && d.zeroCopy {
+		if d.r.limit > 0 && d.r.n+int64(l) > d.r.limit {
+			return "", errMaxBytes
+		}
+		buf := nx.Next(l)
+		d.r.n += int64(len(buf))
+		if len(buf) < l {
+			return "", io.ErrUnexpectedEOF
+		}
+		if d.validateUTF8 && !utf8.Valid(buf) {
+			return "", errInvalidUTF8
+		}
+		return *(*string)(unsafe.Pointer(&buf)), nil
+	}
+	buf := make([]byte, l)
+	if _, err = io.ReadFull(d.r, buf); err != nil {
+		return "", err
+	}
+	if d.validateUTF8 && !utf8.Valid(buf) {
+		return "", errInvalidUTF8
+	}
+	return string(buf), nil
+}
+
+var errInvalidUTF8 = errors.New("binary: invalid UTF-8 in string")
+
+// readSliceLen reads a slice or map length prefix as written by
+// Encoder.writeSliceLen.
+func (d *Decoder) readSliceLen() (l int, isNil bool, err error) {
+	if !d.PreserveNil {
+		l, err = d.readLen()
+		return
+	}
+	var n uint64
+	if n, err = d.readLenPrefix(); err != nil {
+		return
+	}
+	if n == 0 {
+		return 0, true, nil
+	}
+	l, err = d.checkLen(n - 1)
+	return
+}
+
+// enter records a descent into a nested value, failing if the nesting
+// exceeds MaxDepth. Each successful call must be paired with a call to leave.
+func (d *Decoder) enter() error {
+	if d.MaxDepth > 0 && d.depth >= d.MaxDepth {
+		return fmt.Errorf("binary: nesting exceeds maximum depth of %d", d.MaxDepth)
+	}
+	d.depth++
+	return nil
+}
+
+func (d *Decoder) leave() {
+	d.depth--
+}
+
+// readArrayLen reads the length prefix of an array of type t, checking it
+// against ArrayLenMismatch.
+func (d *Decoder) readArrayLen(t reflect.Type) (int, error) {
+	l, err := d.readLen()
+	if err != nil {
+		return 0, err
+	}
+	if l < t.Len() && d.ArrayLenMismatch&ArrayLenPad == 0 ||
+		l > t.Len() && d.ArrayLenMismatch&ArrayLenTruncate == 0 {
+		return 0, fmt.Errorf("binary: encoded length %d of %s does not match", l, t)
+	}
+	return l, nil
+}
+
+func (d *Decoder) checkLen(l uint64) (int, error) {
+	if d.MaxLen > 0 && l > uint64(d.MaxLen) {
+		return 0, fmt.Errorf("binary: length %d exceeds maximum of %d", l, d.MaxLen)
+	}
+	if l > math.MaxInt {
+		return 0, fmt.Errorf("binary: length %d overflows int", l)
+	}
+	return int(l), nil
+}
+
+// Reset directs the decoder to read from r, retaining its configuration.
+func (d *Decoder) Reset(r io.Reader) {
+	if d.fr != nil {
+		d.fr.(flate.Resetter).Reset(r, nil)
+		return
+	}
+	d.r.Reader = r
+}
+
+// SetEndian sets the byte order used for fixed-size values read by this
+// decoder. A nil order resets it to DefaultEndian.
+func (d *Decoder) SetEndian(order binary.ByteOrder) {
+	if order == nil {
+		order = DefaultEndian
+	}
+	d.Order = order
+}
+
+// SetZeroCopy controls whether decoded strings may alias the underlying
+// reader's buffer rather than being copied. This only takes effect for a
+// decoder created by NewBytesDecoder, or if the reader has a method
+// Next(n int) []byte, as *bytes.Buffer does. A *bytes.Reader does not give
+// access to its bytes, so decode a byte slice with NewBytesDecoder instead.
+//
+// With zero-copy enabled, decoded strings are only valid for as long as the
+// buffer they were decoded from is neither modified nor reused.
+func (d *Decoder) SetZeroCopy(enabled bool) {
+	d.zeroCopy = enabled
+}
+
+// SetValidateUTF8 controls whether decoded strings are checked to be valid
+// UTF-8, failing with an error if not.
+func (d *Decoder) SetValidateUTF8(enabled bool) {
+	d.validateUTF8 = enabled
+}
+
+// SliceHint sets the capacity of the next slice that the decoder allocates to
+// at least n, so that elements can be appended to it afterwards without it
+// being reallocated. The capacity is never less than the encoded length of
+// the slice, nor more than MaxLen if that is set. The hint applies to a
+// single allocation, and is not used if a slice is decoded into the existing
+// backing array of the destination.
+func (d *Decoder) SliceHint(n int) {
+	d.sliceHint = n
+}
+
+// sliceCap returns the capacity to allocate for a slice of encoded length l,
+// consuming any hint given by SliceHint.
+func (d *Decoder) sliceCap(l int) int {
+	c := d.sliceHint
+	d.sliceHint = 0
+	if d.MaxLen > 0 && c > d.MaxLen {
+		c = d.MaxLen
+	}
+	if c < l {
+		c = l
+	}
+	return c
+}
+
+// Decode reads the next encoded value from the underlying reader into v,
+// which must be a pointer. It returns io.EOF if the input ends before any of
+// the value is read, and io.ErrUnexpectedEOF if it ends part way through.
+// These are returned as they are, so that they can be compared with ==, and
+// so carry no position. Other errors within a map also give the number of
+// entries read, and a map cut short still holds the entries read before the
+// input ended.
+// A panic during decoding, such as from an UnmarshalBinary method given
+// malformed input, is recovered and returned as an error.
+func (d *Decoder) Decode(v interface{}) error {
+	return d.DecodeValue(reflect.ValueOf(v))
+}
+
+// DecodeEach repeatedly decodes values into v, calling fn after each one,
+// until the input ends cleanly between values. It returns nil at the end of
+// the input, io.ErrUnexpectedEOF if the input ends part way through a value,
+// and otherwise the first error returned by Decode or fn.
+func (d *Decoder) DecodeEach(v interface{}, fn func() error) error {
+	for {
+		if err := d.Decode(v); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+}
+
+// DecodeValue is like Decode but takes a reflect.Value, which must either be
+// a non-nil pointer or be settable.
+func (d *Decoder) DecodeValue(rv reflect.Value) (err error) {
+	defer recoverPanic(&err)
+	switch {
+	case !rv.IsValid():
+		return errors.New("binary: cannot Decode into nil")
+	case rv.Kind() == reflect.Ptr && rv.IsNil():
+		return errors.New("binary: cannot Decode into nil pointer of type " + rv.Type().String())
+	case rv.Kind() == reflect.Ptr:
+		rv = rv.Elem()
+	case !rv.CanSet():
+		return errors.New("binary: can only Decode to pointer type, not " + rv.Type().String())
+	}
+	if d.TrackRefs && d.refs == nil {
+		d.refs = []reflect.Value{rv.Addr()}
+		defer func() { d.refs = nil }()
+	}
+	if d.MaxBytes > 0 && d.r.limit == 0 {
+		d.r.limit = d.r.n + int64(d.MaxBytes)
+		defer func() { d.r.limit = 0 }()
+	}
+	start := d.r.n
+	return d.unexpectedEOF(start, d.decodeValue(rv))
+}
+
+// unexpectedEOF converts io.EOF to io.ErrUnexpectedEOF if any input has been
+// consumed since the reader was at offset start.
+func (d *Decoder) unexpectedEOF(start int64, err error) error {
+	if err == io.EOF && d.r.n != start {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// decodeValue decodes into the addressable value rv.
+func (d *Decoder) decodeValue(rv reflect.Value) (err error) {
+	if err = d.enter(); err != nil {
+		return
+	}
+	defer d.leave()
+
+	t := rv.Type()
+	if c, ok := lookupCodec(t); ok {
+		return c.dec(d, rv)
+	}
+	if t.Kind() == reflect.Ptr {
+		return d.decodePtr(rv)
+	}
+	switch t {
+	case uint8Type, int8Type:
+		var c byte
+		if c, err = d.r.ReadByte(); err != nil {
+			return
+		}
+		if t == uint8Type {
+			rv.SetUint(uint64(c))
+		} else {
+			rv.SetInt(int64(int8(c)))
+		}
+		return
+
+	case durationType:
+		var buf []byte
+		if buf, err = d.readFixed(8); err != nil {
+			return
+		}
+		rv.SetInt(int64(d.Order.Uint64(buf)))
+		return
+
+	case bytesType, ipType, rawValueType: // fast-path byte slices
+		var l int
+		var isNil bool
+		if l, isNil, err = d.readSliceLen(); err != nil {
+			return
+		}
+		if isNil {
+			rv.SetBytes(nil)
+			return
+		}
+		var buf []byte
+		if old := rv.Bytes(); old != nil && l <= cap(old) {
+			buf = old[:l]
+		} else {
+			buf = make([]byte, l, d.sliceCap(l))
+		}
+		if _, err = io.ReadFull(d.r, buf); err != nil {
+			return
+		}
+		rv.SetBytes(buf)
+		return
+
+	case blobType:
+		return d.decodeBlob(rv)
+
+	case bufferType:
+		var buf []byte
+		if buf, err = d.readBytes(); err != nil {
+			return
+		}
+		bb := rv.Addr().Interface().(*bytes.Buffer)
+		bb.Reset()
+		bb.Write(buf)
+		return
+
+	case syncMapType:
+		return d.decodeSyncMap(rv)
+	}
+	if nullTypes[t] {
+		return d.decodeNull(rv)
+	}
+	if hooks := typeFlags(t) & (postUnmarshalHook | validateHook); hooks != 0 {
+		defer func() {
+			if err == nil {
+				err = afterDecode(rv, hooks)
+			}
+		}()
+	}
+
+	// Check if the type implements the encoding.BinaryUnmarshaler interface, and use it if so.
+	if rv.Kind() != reflect.Interface {
+		switch u := rv.Addr().Interface().(type) {
+		case *big.Float:
+			var buf []byte
+			if buf, err = d.readBytes(); err != nil {
+				return
+			}
+			return u.GobDecode(buf)
+
+		case encoding.BinaryUnmarshaler:
+			var buf []byte
+			if buf, err = d.readBytes(); err != nil {
+				return
+			}
+			return u.UnmarshalBinary(buf)
+
+		// Fall back to encoding.TextUnmarshaler.
+		case encoding.TextUnmarshaler:
+			var buf []byte
+			if buf, err = d.readBytes(); err != nil {
+				return
+			}
+			return u.UnmarshalText(buf)
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Array:
+		n := t.Len()
+		l := n
+		if d.ArrayLengths {
+			if l, err = d.readArrayLen(t); err != nil {
+				return
+			}
+		}
+		m := l
+		if m > n {
+			m = n
+		}
+		if isByteType(t.Elem()) {
+			if _, err = io.ReadFull(d.r, rv.Slice(0, m).Bytes()); err != nil {
+				return
+			}
+		} else {
+			for i := 0; i < m; i++ {
+				if err = d.decodeValue(rv.Index(i)); err != nil {
+					return withIndex(err, i)
+				}
+			}
+		}
+		for i := m; i < n; i++ {
+			rv.Index(i).Set(reflect.Zero(t.Elem()))
+		}
+		if l > n {
+			return d.skipArrayTail(t, n, l)
+		}
+
+	case reflect.Slice:
+		var l int
+		var isNil bool
+		if l, isNil, err = d.readSliceLen(); err != nil {
+			return
+		}
+		switch {
+		case isNil:
+			rv.Set(reflect.Zero(t))
+		case !rv.IsNil() && l <= rv.Cap():
+			// Reuse the existing backing array.
+			rv.SetLen(l)
+			return d.decodeElems(rv, 0, l)
+		default:
+			return d.decodeNewSlice(rv, l)
+		}
+
+	case reflect.Struct:
+		err = d.decodeFields(rv)
+
+	case reflect.Map:
+		var l int
+		var isNil bool
+		if l, isNil, err = d.readSliceLen(); err != nil {
+			return
+		}
+		merge := d.MergeMaps && !rv.IsNil()
+		switch {
+		case isNil && merge:
+			return
+		case isNil:
+			rv.Set(reflect.Zero(t))
+			return
+		case !merge:
+			// Trust the length only so far before any entries are read.
+			n := l
+			if n > maxMapPrealloc {
+				n = maxMapPrealloc
+			}
+			rv.Set(reflect.MakeMapWithSize(t, n))
+		}
+		// Keys and values are decoded into temporaries that are zeroed and
+		// reused for each entry, as SetMapIndex copies them into the map.
+		// Repeated keys are not an error, as keys that differ when encoded
+		// can decode as equal, such as times normalized by Encoder.UTC, and
+		// the last value wins.
+		kv := reflect.New(t.Key()).Elem()
+		vv := reflect.New(t.Elem()).Elem()
+		kz := reflect.Zero(t.Key())
+		vz := reflect.Zero(t.Elem())
+		for i := 0; i < l; i++ {
+			kv.Set(kz)
+			if err = d.decodeValue(kv); err != nil {
+				return withMapEntry(withIndex(err, i), i, l)
+			}
+			vv.Set(vz)
+			if err = d.decodeValue(vv); err != nil {
+				return withMapEntry(withKey(err, kv), i, l)
+			}
+			rv.SetMapIndex(kv, vv)
+		}
+
+	case reflect.Interface:
+		err = d.decodeInterface(rv)
+
+	case reflect.String:
+		var str string
+		if str, err = d.readString(); err != nil {
+			return
+		}
+		rv.SetString(str)
+
+	case reflect.Bool, reflect.Int, reflect.Uint, reflect.Uintptr,
+		reflect.Int8, reflect.Uint8, reflect.Int16, reflect.Uint16,
+		reflect.Int32, reflect.Uint32, reflect.Int64, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		err = d.decodeFixed(rv)
+
+	default:
+		return errors.New("binary: unsupported type " + t.String())
+	}
+	return
+}
+
+// maxPrealloc is the largest number of bytes allocated for the elements of a
+// slice before any of them have been read, so that a short input claiming a
+// long slice of large elements cannot force a huge allocation.
+const maxPrealloc = 64 << 10
+
+// maxMapPrealloc is the largest number of entries for which a decoded map is
+// sized before any of them have been read.
+const maxMapPrealloc = 1024
+
+// decodeNewSlice decodes l elements into a newly allocated slice, storing it
+// in rv. If the elements would take more than maxPrealloc bytes, the slice is
+// allocated in steps that at most double its length, each taken only once the
+// elements before it have been read.
+func (d *Decoder) decodeNewSlice(rv reflect.Value, l int) error {
+	t := rv.Type()
+	c := d.sliceCap(l)
+	n := l
+	if size := int(t.Elem().Size()); size > 0 && n > maxPrealloc/size {
+		n = maxPrealloc / size
+		if n == 0 {
+			n = 1
+		}
+	}
+	if n == l {
+		rv.Set(reflect.MakeSlice(t, l, c))
+		return d.decodeElems(rv, 0, l)
+	}
+	rv.Set(reflect.MakeSlice(t, n, n))
+	for i := 0; ; {
+		if err := d.decodeElems(rv, i, n); err != nil {
+			return err
+		}
+		if n == l {
+			return nil
+		}
+		i, n = n, 2*n
+		if n >= l {
+			n = l
+		}
+		next := reflect.MakeSlice(t, n, n)
+		if n == l {
+			next = reflect.MakeSlice(t, n, c)
+		}
+		reflect.Copy(next, rv)
+		rv.Set(next)
+	}
+}
+
+// decodeElems decodes the elements of the slice rv from index i up to n.
+func (d *Decoder) decodeElems(rv reflect.Value, i, n int) error {
+	part := rv.Slice(i, n)
+	if isByteType(rv.Type().Elem()) {
+		_, err := io.ReadFull(d.r, part.Bytes())
+		return err
+	}
+	if ok, err := d.decodeFastSlice(part, i); ok {
+		return err
+	}
+	for ; i < n; i++ {
+		if err := d.decodeValue(rv.Index(i)); err != nil {
+			return withIndex(err, i)
+		}
+	}
+	return nil
+}
+
+// intSize returns the width in bytes of int and uint values for the IntSize
+// setting n.
+func intSize(n int) (int, error) {
+	switch n {
+	case 0, 8:
+		return 8, nil
+	case 4:
+		return 4, nil
+	}
+	return 0, fmt.Errorf("binary: invalid IntSize %d", n)
+}
+
+// readFixed reads n bytes into the decoder's scratch buffer.
+func (d *Decoder) readFixed(n int) ([]byte, error) {
+	buf := d.buf[:n]
+	_, err := io.ReadFull(d.r, buf)
+	return buf, err
+}
+
+// decodeFixed decodes a fixed-size boolean or numeric value into rv. int and
+// uint are IntSize bytes wide, and uintptr is always 8 bytes wide.
+func (d *Decoder) decodeFixed(rv reflect.Value) error {
+	n := 8
+	switch rv.Kind() {
+	case reflect.Int, reflect.Uint:
+		var err error
+		if n, err = intSize(d.IntSize); err != nil {
+			return err
+		}
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		n = 1
+	case reflect.Int16, reflect.Uint16:
+		n = 2
+	case reflect.Int32, reflect.Uint32, reflect.Float32:
+		n = 4
+	case reflect.Complex128:
+		n = 16
+	}
+	buf, err := d.readFixed(n)
+	if err != nil {
+		return err
+	}
+	switch rv.Kind() {
+	case reflect.Bool:
+		rv.SetBool(buf[0] != 0)
+	case reflect.Int8:
+		rv.SetInt(int64(int8(buf[0])))
+	case reflect.Int16:
+		rv.SetInt(int64(int16(d.Order.Uint16(buf))))
+	case reflect.Int32:
+		rv.SetInt(int64(int32(d.Order.Uint32(buf))))
+	case reflect.Int:
+		x := int64(int32(d.Order.Uint32(buf)))
+		if n == 8 {
+			x = int64(d.Order.Uint64(buf))
+		}
+		if rv.OverflowInt(x) {
+			return fmt.Errorf("binary: %d overflows %s", x, rv.Type())
+		}
+		rv.SetInt(x)
+	case reflect.Int64:
+		rv.SetInt(int64(d.Order.Uint64(buf)))
+	case reflect.Uint8:
+		rv.SetUint(uint64(buf[0]))
+	case reflect.Uint16:
+		rv.SetUint(uint64(d.Order.Uint16(buf)))
+	case reflect.Uint32:
+		rv.SetUint(uint64(d.Order.Uint32(buf)))
+	case reflect.Uint:
+		x := uint64(d.Order.Uint32(buf))
+		if n == 8 {
+			x = d.Order.Uint64(buf)
+		}
+		if rv.OverflowUint(x) {
+			return fmt.Errorf("binary: %d overflows %s", x, rv.Type())
+		}
+		rv.SetUint(x)
+	case reflect.Uint64:
+		rv.SetUint(d.Order.Uint64(buf))
+	case reflect.Uintptr:
+		// uintptr is always encoded in 8 bytes, but may be narrower.
+		x := d.Order.Uint64(buf)
+		if rv.OverflowUint(x) {
+			return fmt.Errorf("binary: %d overflows %s", x, rv.Type())
+		}
+		rv.SetUint(x)
+	case reflect.Float32:
+		rv.SetFloat(float64(math.Float32frombits(d.Order.Uint32(buf))))
+	case reflect.Float64:
+		rv.SetFloat(math.Float64frombits(d.Order.Uint64(buf)))
+	case reflect.Complex64:
+		rv.SetComplex(complex(
+			float64(math.Float32frombits(d.Order.Uint32(buf))),
+			float64(math.Float32frombits(d.Order.Uint32(buf[4:]))),
+		))
+	case reflect.Complex128:
+		rv.SetComplex(complex(
+			math.Float64frombits(d.Order.Uint64(buf)),
+			math.Float64frombits(d.Order.Uint64(buf[8:])),
+		))
+	}
+	return nil
+}
+
+// decodeFields decodes into the fields of the addressable struct rv in order.
+func (d *Decoder) decodeFields(rv reflect.Value) error {
+	fields := structFields(rv.Type())
+	if isTagged(fields) {
+		return d.decodeTaggedFields(rv, fields)
+	}
+	if isNamed(fields) {
+		return d.decodeNamedFields(rv, fields)
+	}
+	start := d.r.n
+	present, err := d.readPresence(fields)
+	if err != nil {
+		return err
+	}
+	k := 0
+	for i, f := range fields {
+		if f.unexported && !d.IncludeUnexported {
+			continue
+		}
+		if f.optional {
+			k++
+			if !isPresent(present, k-1) {
+				v := fieldValue(rv, f)
+				v.Set(reflect.Zero(v.Type()))
+				continue
+			}
+		}
+		fieldStart := d.r.n
+		if err := d.decodeField(f, fieldValue(rv, f)); err != nil {
+			if err == io.EOF && d.AllowShortStruct && d.r.n == fieldStart && d.r.n != start {
+				d.zeroFields(rv, fields[i:])
+				return nil
+			}
+			if f.inline {
+				return err
+			}
+			return withField(err, f.name)
+		}
+	}
+	return nil
+}
+
+// zeroFields sets those of fields that are decoded in rv to zero.
+func (d *Decoder) zeroFields(rv reflect.Value, fields []field) {
+	for _, f := range fields {
+		if f.unexported && !d.IncludeUnexported {
+			continue
+		}
+		v := fieldValue(rv, f)
+		v.Set(reflect.Zero(v.Type()))
+	}
+}
+
+// decodeField decodes into the value v of the struct field f.
+func (d *Decoder) decodeField(f field, v reflect.Value) error {
+	switch {
+	case f.inline:
+		return d.decodeFields(v)
+	case f.varint:
+		return d.decodeVarint(v)
+	case f.bitset:
+		return d.decodeBitset(v)
+	case f.unixnano:
+		return d.decodeUnixNano(v)
+	case f.asFloat32:
+		return d.decodeAsFloat32(v)
+	case f.fixed != 0:
+		return d.decodeFixedBytes(v, f.fixed)
+	case v.Kind() == reflect.Ptr:
+		return d.decodePtr(v)
+	default:
+		return d.decodeValue(v)
+	}
+}
+
+// decodePtr reads a presence byte and, if set, decodes a value into the
+// pointer rv, allocating it if necessary. Otherwise rv is set to nil. A
+// codec registered for the pointer type is used instead.
+func (d *Decoder) decodePtr(rv reflect.Value) error {
+	if c, ok := lookupCodec(rv.Type()); ok {
+		return c.dec(d, rv)
+	}
+	if d.TrackRefs {
+		return d.decodeRef(rv)
+	}
+	present, err := d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if present == 0 {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+	if rv.IsNil() {
+		rv.Set(reflect.New(rv.Type().Elem()))
+	}
+	if rv.Elem().Kind() == reflect.Ptr {
+		return d.decodePtr(rv.Elem())
+	}
+	return d.decodeValue(rv.Elem())
+}
+
+// decodeVarint reads a varint into the integer rv, as written by
+// Encoder.encodeVarint.
+func (d *Decoder) decodeVarint(rv reflect.Value) error {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, err := d.readSvarint()
+		if err != nil {
+			return err
+		}
+		if rv.OverflowInt(x) {
+			return fmt.Errorf("binary: varint %d overflows %s", x, rv.Type())
+		}
+		rv.SetInt(x)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		x, err := binary.ReadUvarint(d.r)
+		if err != nil {
+			return err
+		}
+		if rv.OverflowUint(x) {
+			return fmt.Errorf("binary: varint %d overflows %s", x, rv.Type())
+		}
+		rv.SetUint(x)
+	default:
+		return errors.New("binary: varint tag on non-integer type " + rv.Type().String())
+	}
+	return nil
+}
+
+// decodeBitset reads a bool slice written by Encoder.encodeBitset into rv.
+func (d *Decoder) decodeBitset(rv reflect.Value) error {
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() != reflect.Bool {
+		return errors.New("binary: bitset tag on non-[]bool type " + rv.Type().String())
+	}
+	l, isNil, err := d.readSliceLen()
+	if err != nil {
+		return err
+	}
+	if isNil {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+	packed := make([]byte, (l+7)/8)
+	if _, err := io.ReadFull(d.r, packed); err != nil {
+		return err
+	}
+	rv.Set(reflect.MakeSlice(rv.Type(), l, l))
+	for i := 0; i < l; i++ {
+		rv.Index(i).SetBool(packed[i/8]&(1<<(i%8)) != 0)
+	}
+	return nil
+}
+
+// decodeUnixNano reads a time.Time written by Encoder.encodeUnixNano into rv.
+func (d *Decoder) decodeUnixNano(rv reflect.Value) error {
+	if rv.Type() != timeType {
+		return errors.New("binary: unixnano tag on non-time.Time type " + rv.Type().String())
+	}
+	buf, err := d.readFixed(8)
+	if err != nil {
+		return err
+	}
+	rv.Set(reflect.ValueOf(time.Unix(0, int64(d.Order.Uint64(buf)))))
+	return nil
+}
+
+// decodeAsFloat32 reads a 4-byte float32 into the float64 rv.
+func (d *Decoder) decodeAsFloat32(rv reflect.Value) error {
+	if rv.Kind() != reflect.Float64 {
+		return errors.New("binary: float32 tag on non-float64 type " + rv.Type().String())
+	}
+	buf, err := d.readFixed(4)
+	if err != nil {
+		return err
+	}
+	rv.SetFloat(float64(math.Float32frombits(d.Order.Uint32(buf))))
+	return nil
+}
+
+// decodeFixedBytes reads n bytes into the byte array or slice rv, as written
+// by Encoder.encodeFixedBytes.
+func (d *Decoder) decodeFixedBytes(rv reflect.Value, n int) error {
+	if err := checkFixed(rv.Type(), n); err != nil {
+		return err
+	}
+	if rv.Kind() == reflect.Array {
+		_, err := io.ReadFull(d.r, rv.Slice(0, n).Bytes())
+		return err
+	}
+	var buf []byte
+	if old := rv.Bytes(); old != nil && n <= cap(old) {
+		buf = old[:n]
+	} else {
+		buf = make([]byte, n)
+	}
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return err
+	}
+	rv.SetBytes(buf)
+	return nil
+}
@@ -1,11 +1,21 @@
 package binary
 
 import (
+	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/big"
+	"net"
+	"net/netip"
 	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -110,6 +120,17 @@ func TestBinaryMarshalUnMarshaler(t *testing.T) {
 	assert.Equal(t, []byte{0x1, 0x13}, b)
 }
 
+func TestMarshalUnmarshalByteSlice(t *testing.T) {
+	v := []byte{1, 2, 3, 4, 5}
+	b, err := Marshal(v)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x5, 1, 2, 3, 4, 5}, b)
+	var res []byte
+	assert.NoError(t, Unmarshal(b, &res))
+	assert.Equal(t, v, res)
+	assert.Error(t, Unmarshal(b[:3], &res))
+}
+
 func TestMarshalUnMarshalTypeAliases(t *testing.T) {
 	type Foo int64
 	f := Foo(32)
@@ -118,6 +139,66 @@ func TestMarshalUnMarshalTypeAliases(t *testing.T) {
 	assert.Equal(t, []byte{0x20, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0}, b)
 }
 
+func TestNamedScalarTypes(t *testing.T) {
+	type Flag bool
+	type Name string
+	type Ratio float32
+	type Code uint16
+	type S struct {
+		Flag  Flag
+		Name  Name
+		Ratio Ratio
+		Codes []Code
+		Names []Name
+		Flags map[Name]Flag
+	}
+	s := S{
+		Flag:  true,
+		Name:  "n",
+		Ratio: 0.5,
+		Codes: []Code{1},
+		Names: []Name{"a"},
+		Flags: map[Name]Flag{"f": true},
+	}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	builtin, err := Marshal(struct {
+		Flag  bool
+		Name  string
+		Ratio float32
+		Codes []uint16
+		Names []string
+		Flags map[string]bool
+	}{true, "n", 0.5, []uint16{1}, []string{"a"}, map[string]bool{"f": true}})
+	assert.NoError(t, err)
+	assert.Equal(t, builtin, data)
+
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+
+	for _, v := range []interface{}{Flag(true), Name("name")} {
+		data, err := Marshal(v)
+		assert.NoError(t, err)
+		ptr := reflect.New(reflect.TypeOf(v))
+		assert.NoError(t, Unmarshal(data, ptr.Interface()))
+		assert.Equal(t, v, ptr.Elem().Interface())
+	}
+}
+
+func TestMarshalUnmarshalMaxUint(t *testing.T) {
+	if strconv.IntSize != 64 {
+		t.Skip("requires a 64-bit uint")
+	}
+	v := uint(math.MaxUint)
+	b, err := Marshal(v)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, b)
+	var res uint
+	assert.NoError(t, Unmarshal(b, &res))
+	assert.Equal(t, v, res)
+}
+
 func TestStructWithStruct(t *testing.T) {
 	type T1 struct {
 		ID    uint64
@@ -306,135 +387,2636 @@ func TestStructWithPrivateFields(t *testing.T) {
 
 }
 
-func BenchmarkEncodeStructI1(b *testing.B) {
-	type Struct struct {
-		S struct {
-			I int64
-		}
+// oneByteReader returns at most one byte per call to Read.
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (o *oneByteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
 	}
-	var s Struct
-	s.S.I = 1024
-	buf := new(bytes.Buffer)
+	return o.r.Read(p[:1])
+}
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		enc := NewEncoder(buf)
-		_ = enc.Encode(&s)
+func TestDecodeShortReads(t *testing.T) {
+	s := s1v
+	b, err := Marshal(s)
+	assert.NoError(t, err)
+	res := &s1{}
+	err = NewDecoder(&oneByteReader{bytes.NewReader(b)}).Decode(res)
+	assert.NoError(t, err)
+	assert.Equal(t, s, res)
+
+	u := &s2{}
+	err = NewDecoder(&oneByteReader{bytes.NewReader([]byte{0x1, 0x13})}).Decode(u)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x13}, u.b)
+
+	var str string
+	err = NewDecoder(&oneByteReader{bytes.NewReader([]byte{0x5, 'a', 'b'})}).Decode(&str)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestEncoderDecoderSetEndian(t *testing.T) {
+	v := uint32(0x01020304)
+
+	le := new(bytes.Buffer)
+	enc := NewEncoder(le)
+	enc.SetEndian(LittleEndian)
+	assert.NoError(t, enc.Encode(v))
+
+	be := new(bytes.Buffer)
+	enc = NewEncoder(be)
+	enc.SetEndian(BigEndian)
+	assert.NoError(t, enc.Encode(v))
+
+	assert.Equal(t, []byte{0x4, 0x3, 0x2, 0x1}, le.Bytes())
+	assert.Equal(t, []byte{0x1, 0x2, 0x3, 0x4}, be.Bytes())
+
+	var out uint32
+	dec := NewDecoder(be)
+	dec.SetEndian(BigEndian)
+	assert.NoError(t, dec.Decode(&out))
+	assert.Equal(t, v, out)
+
+	dec = NewDecoder(bytes.NewReader([]byte{0x4, 0x3, 0x2, 0x1}))
+	dec.SetEndian(nil)
+	assert.Equal(t, DefaultEndian, dec.Order)
+	assert.NoError(t, dec.Decode(&out))
+	assert.Equal(t, v, out)
+}
+
+func TestStructWithSkipTag(t *testing.T) {
+	type S struct {
+		A     int16
+		Cache string `binary:"-"`
+		B     int16
+	}
+	s := S{A: 1, Cache: "derived", B: 2}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x1, 0x0, 0x2, 0x0}, data)
+
+	res := S{Cache: "untouched"}
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, S{A: 1, Cache: "untouched", B: 2}, res)
+}
+
+func TestSize(t *testing.T) {
+	for _, v := range []interface{}{
+		s0v,
+		s1v,
+		&s2{[]byte{0x13}},
+		[]byte{1, 2, 3},
+		map[string][]int{"a": {1, 2}, "b": nil},
+		&[2]string{"foo", "bar"},
+		uint(7),
+		true,
+		complex64(1 + 2i),
+	} {
+		b, err := Marshal(v)
+		assert.NoError(t, err)
+		n, err := Size(v)
+		assert.NoError(t, err)
+		assert.Equal(t, len(b), n, "%T", v)
 	}
 
+	_, err := Size(make(chan int))
+	assert.Error(t, err)
 }
 
-func BenchmarkEncodeStructI2(b *testing.B) {
-	type Struct struct {
-		S struct {
-			I int64
-		}
+func TestStructWithPointerFields(t *testing.T) {
+	type S struct {
+		A *int
+		B **int
+		C *s0
 	}
-	var s Struct
-	s.S.I = 1024
+
+	data, err := Marshal(S{})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x0, 0x0, 0x0}, data)
+	one := 1
+	res := S{A: &one}
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, S{}, res)
+
+	i := 42
+	pi := &i
+	s := S{A: &i, B: &pi, C: s0v}
+	data, err = Marshal(s)
+	assert.NoError(t, err)
+	n, err := Size(s)
+	assert.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	res = S{}
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+}
+
+func TestEncoderDecoderReset(t *testing.T) {
+	fresh := new(bytes.Buffer)
+	assert.NoError(t, NewEncoder(fresh).Encode(s1v))
+
+	first := new(bytes.Buffer)
+	enc := NewEncoder(first)
+	enc.SetEndian(BigEndian)
+	assert.NoError(t, enc.Encode(s0v))
+
+	enc.SetEndian(LittleEndian)
+	reused := new(bytes.Buffer)
+	enc.Reset(reused)
+	assert.NoError(t, enc.Encode(s1v))
+	assert.Equal(t, fresh.Bytes(), reused.Bytes())
+
+	dec := NewDecoder(first)
+	dec.SetEndian(BigEndian)
+	res0 := &s0{}
+	assert.NoError(t, dec.Decode(res0))
+	assert.Equal(t, s0v, res0)
+
+	dec.SetEndian(LittleEndian)
+	dec.Reset(reused)
+	res1 := &s1{}
+	assert.NoError(t, dec.Decode(res1))
+	assert.Equal(t, s1v, res1)
+}
+
+func TestEncoderSortKeys(t *testing.T) {
+	m := map[string]int16{}
+	for i := 0; i < 32; i++ {
+		m[strconv.Itoa(i)] = int16(i)
+	}
+	marshal := func() []byte {
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(buf)
+		enc.SortKeys = true
+		assert.NoError(t, enc.Encode(m))
+		return buf.Bytes()
+	}
+	first := marshal()
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, first, marshal())
+	}
+	var res map[string]int16
+	assert.NoError(t, Unmarshal(first, &res))
+	assert.Equal(t, m, res)
+
 	buf := new(bytes.Buffer)
 	enc := NewEncoder(buf)
+	enc.SortKeys = true
+	assert.NoError(t, enc.Encode(map[int8]bool{3: true, -1: false, 2: true}))
+	assert.Equal(t, []byte{0x3, 0xff, 0x0, 0x2, 0x1, 0x3, 0x1}, buf.Bytes())
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		_ = enc.Encode(&s)
+	err := enc.Encode(map[[1]int]bool{{1}: true})
+	assert.Error(t, err)
+}
+
+func TestDecoderMaxLen(t *testing.T) {
+	// A varint length prefix of 2^31 followed by nothing.
+	huge := []byte{0x80, 0x80, 0x80, 0x80, 0x8}
+	var s []int32
+	assert.Error(t, Unmarshal(huge, &s))
+	var b []byte
+	assert.Error(t, Unmarshal(huge, &b))
+	var str string
+	assert.Error(t, Unmarshal(huge, &str))
+	var m map[string]string
+	assert.Error(t, Unmarshal(huge, &m))
+	assert.Error(t, Unmarshal(huge, &s2{}))
+
+	dec := NewDecoder(bytes.NewReader([]byte{0x3, 'a', 'b', 'c'}))
+	dec.MaxLen = 2
+	assert.Error(t, dec.Decode(&str))
+	dec = NewDecoder(bytes.NewReader([]byte{0x3, 'a', 'b', 'c'}))
+	dec.MaxLen = 3
+	assert.NoError(t, dec.Decode(&str))
+	assert.Equal(t, "abc", str)
+}
+
+// allocated returns the number of bytes allocated while running fn.
+func allocated(fn func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func TestDecodeHostileLen(t *testing.T) {
+	// A length prefix of MaxLen elements followed by nothing must not
+	// allocate room for all of them up front.
+	hostile := binary.AppendUvarint(nil, uint64(DefaultMaxLen))
+	n := allocated(func() {
+		var s [][256]byte
+		assert.Equal(t, io.ErrUnexpectedEOF, Unmarshal(hostile, &s))
+	})
+	assert.Less(t, n, uint64(1<<20))
+	n = allocated(func() {
+		var s [][4096]byte
+		assert.Equal(t, io.ErrUnexpectedEOF, Unmarshal(hostile, &s))
+	})
+	assert.Less(t, n, uint64(1<<20))
+	n = allocated(func() {
+		var m map[int64][64]byte
+		assert.Equal(t, io.ErrUnexpectedEOF, Unmarshal(hostile, &m))
+	})
+	assert.Less(t, n, uint64(1<<20))
+
+	// Slices too large to allocate up front still decode, growing as their
+	// elements are read.
+	big := make([][256]byte, 1000)
+	for i := range big {
+		big[i][0] = byte(i)
+	}
+	data, err := Marshal(big)
+	assert.NoError(t, err)
+	var res [][256]byte
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, big, res)
+
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.SliceHint(2000)
+	res = nil
+	assert.NoError(t, dec.Decode(&res))
+	assert.Equal(t, big, res)
+	assert.Equal(t, 2000, cap(res))
+
+	// Errors give the index within the whole slice.
+	strs := make([]string, 10000)
+	strs[9000] = "\xff"
+	data, err = Marshal(strs)
+	assert.NoError(t, err)
+	dec = NewDecoder(bytes.NewReader(data))
+	dec.SetValidateUTF8(true)
+	var resStrs []string
+	assert.EqualError(t, dec.Decode(&resStrs), "binary: field [9000]: invalid UTF-8 in string")
+}
+
+func TestStructWithVarintTag(t *testing.T) {
+	type Fixed struct {
+		A int
+		B int16
+		C uint32
+	}
+	type Varint struct {
+		A int    `binary:"varint"`
+		B int16  `binary:"varint"`
+		C uint32 `binary:"varint"`
+	}
+	fixed, err := Marshal(Fixed{A: -3, B: 60, C: 7})
+	assert.NoError(t, err)
+	assert.Equal(t, 14, len(fixed))
+
+	s := Varint{A: -3, B: 60, C: 7}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x5, 0x78, 0x7}, data)
+
+	var res Varint
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+
+	type Overflow struct {
+		A int8 `binary:"varint"`
 	}
+	data, err = Marshal(Varint{A: 1000})
+	assert.NoError(t, err)
+	assert.Error(t, Unmarshal(data, &Overflow{}))
 
+	type Bad struct {
+		A string `binary:"varint"`
+	}
+	_, err = Marshal(Bad{})
+	assert.Error(t, err)
 }
 
-func BenchmarkEncodeStructI3(b *testing.B) {
-	type Struct struct {
-		S struct {
-			I int64
-		}
+func TestMarshalAppend(t *testing.T) {
+	buf := make([]byte, 0, 128)
+	buf, err := MarshalAppend(buf, s0v)
+	assert.NoError(t, err)
+	assert.Equal(t, s0b, buf)
+	buf, err = MarshalAppend(buf, s1v)
+	assert.NoError(t, err)
+	assert.Equal(t, append(append([]byte{}, s0b...), svb...), buf)
+
+	dec := NewDecoder(bytes.NewReader(buf))
+	res0 := &s0{}
+	assert.NoError(t, dec.Decode(res0))
+	assert.Equal(t, s0v, res0)
+	res1 := &s1{}
+	assert.NoError(t, dec.Decode(res1))
+	assert.Equal(t, s1v, res1)
+
+	_, err = MarshalAppend(buf, make(chan int))
+	assert.Error(t, err)
+}
+
+func TestPreserveNilSlices(t *testing.T) {
+	type S struct {
+		NilStrings   []string
+		EmptyStrings []string
+		NilBytes     []byte
+		EmptyBytes   []byte
+		Ints         []int16
 	}
-	var s Struct
-	s.S.I = 1024
+	s := S{EmptyStrings: []string{}, EmptyBytes: []byte{}, Ints: []int16{1}}
+
 	buf := new(bytes.Buffer)
 	enc := NewEncoder(buf)
+	enc.PreserveNil = true
+	assert.NoError(t, enc.Encode(s))
+	assert.Equal(t, []byte{0x0, 0x1, 0x0, 0x1, 0x2, 0x1, 0x0}, buf.Bytes())
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		err := enc.Encode(&s)
-		if err != nil {
-			b.Fatalf("error: %v\n", err)
-		}
+	res := S{NilStrings: []string{"x"}, NilBytes: []byte("x")}
+	dec := NewDecoder(buf)
+	dec.PreserveNil = true
+	assert.NoError(t, dec.Decode(&res))
+	assert.Nil(t, res.NilStrings)
+	assert.NotNil(t, res.EmptyStrings)
+	assert.Equal(t, 0, len(res.EmptyStrings))
+	assert.Nil(t, res.NilBytes)
+	assert.NotNil(t, res.EmptyBytes)
+	assert.Equal(t, 0, len(res.EmptyBytes))
+	assert.Equal(t, s, res)
+}
+
+func TestStructWithDuration(t *testing.T) {
+	type S struct {
+		Timeout time.Duration
+		Retries int8
 	}
+	s := S{Timeout: 1500 * time.Millisecond, Retries: 3}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x0, 0x2f, 0x68, 0x59, 0x0, 0x0, 0x0, 0x0, 0x3}, data)
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
 
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.SetEndian(BigEndian)
+	d := -time.Second
+	assert.NoError(t, enc.Encode(&d))
+	assert.Equal(t, []byte{0xff, 0xff, 0xff, 0xff, 0xc4, 0x65, 0x36, 0x0}, buf.Bytes())
+	dec := NewDecoder(buf)
+	dec.SetEndian(BigEndian)
+	var out time.Duration
+	assert.NoError(t, dec.Decode(&out))
+	assert.Equal(t, d, out)
 }
 
-type bufferT struct {
-	buf []byte
+type textOnly struct {
+	a, b string
 }
 
-func (buf *bufferT) Read(data []byte) (int, error) {
-	n := copy(data, buf.buf)
-	if n != len(data) {
-		panic(fmt.Errorf("read too few bytes. got=%d want=%d", n, len(data)))
-	}
-	return n, nil
+func (t textOnly) MarshalText() ([]byte, error) {
+	return []byte(t.a + ":" + t.b), nil
 }
 
-func getTestBuffer(b *testing.B) io.Reader {
-	return &bufferT{
-		buf: []byte{0, 4, 0, 0, 0, 0, 0, 0},
+func (t *textOnly) UnmarshalText(data []byte) error {
+	parts := strings.SplitN(string(data), ":", 2)
+	if len(parts) != 2 {
+		return errors.New("expected a:b")
 	}
+	t.a, t.b = parts[0], parts[1]
+	return nil
 }
 
-func BenchmarkDecodeStructI1(b *testing.B) {
+func TestTextMarshalerFallback(t *testing.T) {
+	type S struct {
+		T textOnly
+		N int8
+	}
+	s := S{T: textOnly{"x", "yz"}, N: 1}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x4, 'x', ':', 'y', 'z', 0x1}, data)
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
 
-	type Struct struct {
-		I int64
+	assert.Error(t, Unmarshal([]byte{0x2, 'x', 'y', 0x1}, &res))
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	for _, tc := range []struct {
+		data []byte
+		v    interface{}
+	}{
+		{s0b, &s0{}},
+		{svb, &s1{}},
+	} {
+		assert.Equal(t, io.EOF, Unmarshal(nil, tc.v))
+		for i := 1; i < len(tc.data); i++ {
+			err := Unmarshal(tc.data[:i], tc.v)
+			assert.Equal(t, io.ErrUnexpectedEOF, err, "truncated at %d", i)
+		}
 	}
+}
 
-	var s Struct
+func TestStructWithBigNumbers(t *testing.T) {
+	type S struct {
+		Int   *big.Int
+		Float big.Float
+		Nil   *big.Int
+	}
+	i, ok := new(big.Int).SetString("123456789012345678901234567890", 10)
+	assert.True(t, ok)
+	s := S{Int: i}
+	s.Float.SetString("1.5e100")
 
-	buf := getTestBuffer(b)
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		dec := NewDecoder(buf)
-		_ = dec.Decode(&s)
+	for _, v := range []interface{}{s, &s} {
+		data, err := Marshal(v)
+		assert.NoError(t, err)
+		var res S
+		assert.NoError(t, Unmarshal(data, &res))
+		assert.Equal(t, 0, s.Int.Cmp(res.Int))
+		assert.Equal(t, 0, s.Float.Cmp(&res.Float))
+		assert.Nil(t, res.Nil)
 	}
 
+	// Floats keep their full precision, rounding mode and accuracy.
+	f, _, err := big.ParseFloat("1.00000000000000000000000000000001", 10, 200, big.ToZero)
+	assert.NoError(t, err)
+	data, err := Marshal(f)
+	assert.NoError(t, err)
+	res := new(big.Float)
+	assert.NoError(t, Unmarshal(data, res))
+	assert.Equal(t, 0, f.Cmp(res))
+	assert.Equal(t, uint(200), res.Prec())
+	assert.Equal(t, big.ToZero, res.Mode())
+	assert.Equal(t, f.Acc(), res.Acc())
+	assert.Equal(t, f.Text('g', 40), res.Text('g', 40))
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(res))
+	assert.Equal(t, io.EOF, dec.Decode(res))
+}
+
+func TestDecoderZeroCopy(t *testing.T) {
+	data, err := Marshal(s0v)
+	assert.NoError(t, err)
+	dec := NewDecoder(bytes.NewBuffer(data))
+	dec.SetZeroCopy(true)
+	res := &s0{}
+	assert.NoError(t, dec.Decode(res))
+	assert.Equal(t, s0v, res)
+
+	// Strings alias the input buffer.
+	data[1] = 'Z'
+	assert.Equal(t, "Z", res.A)
+
+	dec = NewDecoder(bytes.NewBuffer(data[:3]))
+	dec.SetZeroCopy(true)
+	assert.Equal(t, io.ErrUnexpectedEOF, dec.Decode(res))
+
+	// A decoder over a byte slice aliases it too, but only when asked.
+	data, err = Marshal(s0v)
+	assert.NoError(t, err)
+	res = &s0{}
+	assert.NoError(t, Unmarshal(data, res))
+	data[1] = 'Z'
+	assert.Equal(t, s0v.A, res.A)
+
+	dec = NewBytesDecoder(data)
+	dec.SetZeroCopy(true)
+	assert.NoError(t, dec.Decode(res))
+	assert.Equal(t, "Z", res.A)
+	data[1] = 'Y'
+	assert.Equal(t, "Y", res.A)
+	assert.Equal(t, io.EOF, dec.Decode(res))
+
+	dec = NewBytesDecoder(data[:3])
+	dec.SetZeroCopy(true)
+	assert.Equal(t, io.ErrUnexpectedEOF, dec.Decode(res))
 }
 
-func BenchmarkDecodeStructI2(b *testing.B) {
+func TestEncodeDecodeValue(t *testing.T) {
+	for _, v := range []interface{}{s0v, s1v, &[2]string{"a", "b"}, uint16(7)} {
+		want, err := Marshal(v)
+		assert.NoError(t, err)
 
-	type Struct struct {
-		S struct {
-			I int64
-		}
+		buf := new(bytes.Buffer)
+		assert.NoError(t, NewEncoder(buf).EncodeValue(reflect.ValueOf(v)))
+		assert.Equal(t, want, buf.Bytes())
+
+		// Addressable non-pointer values encode identically.
+		rv := reflect.New(reflect.Indirect(reflect.ValueOf(v)).Type()).Elem()
+		rv.Set(reflect.Indirect(reflect.ValueOf(v)))
+		buf.Reset()
+		assert.NoError(t, NewEncoder(buf).EncodeValue(rv))
+		assert.Equal(t, want, buf.Bytes())
+
+		// Decode both through a pointer and through a settable value.
+		ptr := reflect.New(rv.Type())
+		assert.NoError(t, NewDecoder(bytes.NewReader(want)).DecodeValue(ptr))
+		assert.Equal(t, rv.Interface(), ptr.Elem().Interface())
+		val := reflect.New(rv.Type()).Elem()
+		assert.NoError(t, NewDecoder(bytes.NewReader(want)).DecodeValue(val))
+		assert.Equal(t, rv.Interface(), val.Interface())
 	}
-	var s Struct
 
-	buf := getTestBuffer(b)
-	dec := NewDecoder(buf)
+	err := NewDecoder(bytes.NewReader(s0b)).DecodeValue(reflect.ValueOf(*s0v))
+	assert.Error(t, err)
+	assert.Error(t, NewEncoder(io.Discard).EncodeValue(reflect.Value{}))
+}
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		_ = dec.Decode(&s)
+func TestNetIPAndAddr(t *testing.T) {
+	type Flow struct {
+		SrcIP   net.IP
+		DstIP   net.IP
+		Src     netip.Addr
+		Dst     netip.Addr
+		Mapped  netip.Addr
+		Zoned   netip.Addr
+		Invalid netip.Addr
 	}
+	f := Flow{
+		SrcIP:  net.IPv4(10, 0, 0, 1).To4(),
+		DstIP:  net.ParseIP("2001:db8::1"),
+		Src:    netip.MustParseAddr("192.168.1.1"),
+		Dst:    netip.MustParseAddr("2001:db8::2"),
+		Mapped: netip.MustParseAddr("::ffff:10.1.2.3"),
+		Zoned:  netip.MustParseAddr("fe80::1%eth0"),
+	}
+	data, err := Marshal(f)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x4, 10, 0, 0, 1}, data[:5])
+
+	var res Flow
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, f, res)
+	assert.True(t, res.Src.Is4())
+	assert.True(t, res.Mapped.Is4In6())
+	assert.Equal(t, "eth0", res.Zoned.Zone())
+	assert.False(t, res.Invalid.IsValid())
+
+	ip := net.ParseIP("10.0.0.2")
+	data, err = Marshal(&ip)
+	assert.NoError(t, err)
+	assert.Equal(t, 17, len(data))
+}
+
+func TestDecoderMaxDepth(t *testing.T) {
+	type Nested []Nested
+
+	// Each 0x1 is a slice of length one containing the next slice.
+	data := bytes.Repeat([]byte{0x1}, 100)
+	data = append(data, 0x0)
 
+	var n Nested
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.MaxDepth = 50
+	err := dec.Decode(&n)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "maximum depth of 50")
+	assert.Equal(t, 0, dec.depth)
+
+	dec = NewDecoder(bytes.NewReader(data))
+	dec.MaxDepth = 50
+	assert.Error(t, dec.Skip(&n))
+
+	dec = NewDecoder(bytes.NewReader(data))
+	dec.MaxDepth = 101
+	assert.NoError(t, dec.Decode(&n))
+	assert.Equal(t, 0, dec.depth)
 }
 
-func BenchmarkDecodeStructI3(b *testing.B) {
+func TestDecodeReusesSliceCapacity(t *testing.T) {
+	data, err := Marshal([]int16{1, 2, 3})
+	assert.NoError(t, err)
 
-	type Struct struct {
-		S struct {
-			I int64
-		}
+	backing := make([]int16, 5, 8)
+	out := backing
+	assert.NoError(t, Unmarshal(data, &out))
+	assert.Equal(t, []int16{1, 2, 3}, out)
+	assert.Equal(t, &backing[0], &out[0])
+
+	small := make([]int16, 0, 2)
+	out = small
+	assert.NoError(t, Unmarshal(data, &out))
+	assert.Equal(t, []int16{1, 2, 3}, out)
+	assert.Equal(t, 2, cap(small))
+
+	blob := make([]byte, 0, 16)
+	outb := blob
+	assert.NoError(t, Unmarshal([]byte{0x2, 0xa, 0xb}, &outb))
+	assert.Equal(t, []byte{0xa, 0xb}, outb)
+	assert.Equal(t, &blob[:1][0], &outb[0])
+}
+
+func TestSignedVarintRoundTrip(t *testing.T) {
+	type S struct {
+		V int64 `binary:"varint"`
 	}
-	var s Struct
+	for _, tc := range []struct {
+		v    int64
+		size int
+	}{
+		{-1, 1},
+		{-1000, 2},
+		{math.MinInt64, binary.MaxVarintLen64},
+		{math.MaxInt64, binary.MaxVarintLen64},
+	} {
+		data, err := Marshal(S{tc.v})
+		assert.NoError(t, err)
+		assert.Equal(t, tc.size, len(data), "%d", tc.v)
+		var res S
+		assert.NoError(t, Unmarshal(data, &res))
+		assert.Equal(t, tc.v, res.V)
+	}
+}
 
-	buf := getTestBuffer(b)
-	dec := NewDecoder(buf)
+func TestByteArraysAndSlices(t *testing.T) {
+	type Octet uint8
+	type S struct {
+		Hash   [4]byte
+		Octets []Octet
+		Arr    [2]Octet
+	}
+	s := S{Hash: [4]byte{1, 2, 3, 4}, Octets: []Octet{5, 6}, Arr: [2]Octet{7, 8}}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3, 4, 0x2, 5, 6, 7, 8}, data)
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		err := dec.Decode(&s)
-		if err != nil {
-			b.Fatalf("error: %v\n", err)
-		}
+	assert.Equal(t, io.ErrUnexpectedEOF, Unmarshal(data[:3], &res))
+}
+
+func TestStructWithBitsetTag(t *testing.T) {
+	type S struct {
+		Flags []bool `binary:"bitset"`
+		Plain []bool
+	}
+	flags := make([]bool, 17)
+	for _, i := range []int{0, 3, 8, 15, 16} {
+		flags[i] = true
+	}
+	s := S{Flags: flags, Plain: []bool{true, false}}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x11, 0x09, 0x81, 0x01, 0x2, 0x1, 0x0}, data)
+
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+
+	dec := NewDecoder(bytes.NewReader(append(data, s0b...)))
+	assert.NoError(t, dec.Skip(&S{}))
+	res0 := &s0{}
+	assert.NoError(t, dec.Decode(res0))
+	assert.Equal(t, s0v, res0)
+
+	type Bad struct {
+		Flags []int8 `binary:"bitset"`
+	}
+	_, err = Marshal(Bad{})
+	assert.Error(t, err)
+}
+
+func TestDecodeMapValuesDoNotAlias(t *testing.T) {
+	m := map[string][]int16{"a": {1, 2, 3}, "b": {4}, "c": nil}
+	data, err := Marshal(m)
+	assert.NoError(t, err)
+	var res map[string][]int16
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, []int16{1, 2, 3}, res["a"])
+	assert.Equal(t, []int16{4}, res["b"])
+	assert.Equal(t, 0, len(res["c"]))
+}
+
+func TestRawValue(t *testing.T) {
+	type Envelope struct {
+		Kind    string
+		Payload RawValue
+		Seq     uint16
 	}
+	payload, err := Marshal(s1v)
+	assert.NoError(t, err)
+	e := Envelope{Kind: "s1", Payload: payload, Seq: 7}
+	data, err := Marshal(e)
+	assert.NoError(t, err)
+
+	var res Envelope
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, "s1", res.Kind)
+	assert.Equal(t, uint16(7), res.Seq)
+	assert.Equal(t, RawValue(svb), res.Payload)
+
+	s := &s1{}
+	assert.NoError(t, Unmarshal(res.Payload, s))
+	assert.Equal(t, s1v, s)
 
+	// Re-encoding writes the captured bytes verbatim, even with a codec for
+	// their elements.
+	RegisterCodec(uint8Type,
+		func(e *Encoder, rv reflect.Value) error { return errors.New("codec used") },
+		func(d *Decoder, rv reflect.Value) error { return errors.New("codec used") })
+	t.Cleanup(func() { codecs.Delete(uint8Type) })
+	again, err := Marshal(res)
+	assert.NoError(t, err)
+	assert.Equal(t, data, again)
+	res = Envelope{}
+	assert.NoError(t, Unmarshal(again, &res))
+	assert.Equal(t, RawValue(svb), res.Payload)
+	dec := NewDecoder(bytes.NewReader(again))
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+}
+
+func TestPreserveNilMaps(t *testing.T) {
+	type S struct {
+		NilMap   map[string]int8
+		EmptyMap map[string]int8
+		Map      map[string]int8
+	}
+	s := S{EmptyMap: map[string]int8{}, Map: map[string]int8{"a": 1}}
+
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.PreserveNil = true
+	assert.NoError(t, enc.Encode(s))
+	assert.Equal(t, []byte{0x0, 0x1, 0x2, 0x1, 'a', 0x1}, buf.Bytes())
+
+	res := S{NilMap: map[string]int8{"x": 1}}
+	dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+	dec.PreserveNil = true
+	assert.NoError(t, dec.Decode(&res))
+	assert.Nil(t, res.NilMap)
+	assert.NotNil(t, res.EmptyMap)
+	assert.Equal(t, 0, len(res.EmptyMap))
+	assert.Equal(t, s, res)
+
+	dec = NewDecoder(bytes.NewReader(buf.Bytes()))
+	dec.PreserveNil = true
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(new(uint8)))
+
+	// Without PreserveNil, nil and empty maps both decode as empty.
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	res = S{}
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.NotNil(t, res.NilMap)
+	assert.Equal(t, 0, len(res.NilMap))
+}
+
+func TestMarshalScalarPointers(t *testing.T) {
+	var (
+		b   = true
+		i   = -42
+		i8  = int8(-8)
+		i16 = int16(-16)
+		i32 = int32(-32)
+		i64 = int64(-64)
+		u   = uint(42)
+		u8  = uint8(8)
+		u16 = uint16(16)
+		u32 = uint32(32)
+		u64 = uint64(64)
+		f32 = float32(3.2)
+		f64 = 6.4
+		c64 = complex64(complex(1, 2))
+		c   = complex(3, 4)
+		s   = "hello"
+		d   = time.Second
+	)
+	for _, p := range []interface{}{&b, &i, &i8, &i16, &i32, &i64, &u, &u8, &u16, &u32, &u64, &f32, &f64, &c64, &c, &s, &d} {
+		v := reflect.ValueOf(p).Elem().Interface()
+		t.Run(reflect.TypeOf(v).String(), func(t *testing.T) {
+			expected, err := Marshal(v)
+			assert.NoError(t, err)
+			actual, err := Marshal(p)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
+
+func TestComplexInContainers(t *testing.T) {
+	type S struct {
+		Map   map[string]complex128
+		Slice []complex64
+		Array [2]complex128
+	}
+	s := S{
+		Map:   map[string]complex128{"a": complex(1.5, -2), "b": complex(0, 3)},
+		Slice: []complex64{complex(1, 2), complex(-3, 4.25)},
+		Array: [2]complex128{complex(5, 6), complex(7, 8)},
+	}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	size, err := Size(s)
+	assert.NoError(t, err)
+	assert.Equal(t, len(data), size)
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+}
+
+func TestMarshalTo(t *testing.T) {
+	buf := make([]byte, len(svb))
+	n, err := MarshalTo(buf, s1v)
+	assert.NoError(t, err)
+	assert.Equal(t, len(svb), n)
+	assert.Equal(t, svb, buf)
+
+	buf = make([]byte, len(svb)+4)
+	n, err = MarshalTo(buf, s1v)
+	assert.NoError(t, err)
+	assert.Equal(t, len(svb), n)
+	assert.Equal(t, svb, buf[:n])
+
+	// Nothing is written past the end of a short buffer.
+	backing := make([]byte, len(svb)+4)
+	buf = backing[:len(svb)-1]
+	n, err = MarshalTo(buf, s1v)
+	assert.Equal(t, io.ErrShortBuffer, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, make([]byte, 5), backing[len(buf):])
+
+	// An encoding error takes precedence over the buffer being short.
+	_, err = MarshalTo(make([]byte, 1), []interface{}{"xx", make(chan int)})
+	assert.EqualError(t, err, "binary: field [1]: type not registered for interface: chan int")
+
+	_, err = MarshalTo(buf, make(chan int))
+	assert.Error(t, err)
+}
+
+func TestMarshalToAllocs(t *testing.T) {
+	// The encoding goes straight into buf, however large it is.
+	v := make([]byte, 1<<20)
+	buf := make([]byte, len(v)+8)
+	var err error
+	n := allocated(func() { _, err = MarshalTo(buf, v) })
+	assert.NoError(t, err)
+	assert.Less(t, n, uint64(4<<10))
+}
+
+func TestDecoderDoesNotReadAhead(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	assert.NoError(t, enc.Encode(s1v))
+	assert.NoError(t, enc.Encode(uint16(0xbeef)))
+	assert.NoError(t, enc.Encode("tail"))
+
+	dec := NewDecoder(buf)
+	res := &s1{}
+	assert.NoError(t, dec.Decode(res))
+	assert.Equal(t, s1v, res)
+
+	// The next value is still in the underlying reader.
+	assert.Equal(t, 2+5, buf.Len())
+	raw := make([]byte, 2)
+	_, err := io.ReadFull(buf, raw)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xef, 0xbe}, raw)
+
+	var s string
+	assert.NoError(t, dec.Decode(&s))
+	assert.Equal(t, "tail", s)
+}
+
+func TestDecoderBufioReader(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	assert.NoError(t, enc.Encode("first"))
+	assert.NoError(t, enc.Encode(uint16(0xbeef)))
+	assert.NoError(t, enc.Encode("tail"))
+	total := buf.Len()
+
+	// A *bufio.Reader is read directly rather than wrapped in another
+	// buffer, so it still holds everything the decoder has not consumed.
+	br := bufio.NewReader(buf)
+	dec := NewDecoder(br)
+	assert.Equal(t, io.Reader(br), dec.r.Reader)
+	var s string
+	assert.NoError(t, dec.Decode(&s))
+	assert.Equal(t, "first", s)
+	assert.Equal(t, total-6, br.Buffered())
+
+	var x uint16
+	assert.NoError(t, binary.Read(br, LittleEndian, &x))
+	assert.Equal(t, uint16(0xbeef), x)
+	assert.NoError(t, dec.Decode(&s))
+	assert.Equal(t, "tail", s)
+	assert.Equal(t, 0, br.Buffered())
+}
+
+func TestUintptr(t *testing.T) {
+	type S struct {
+		Handle  uintptr
+		Handles []uintptr
+		Varint  uintptr `binary:"varint"`
+	}
+	s := S{Handle: 0xdeadbeef, Handles: []uintptr{1, 2}, Varint: 300}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0xef, 0xbe, 0xad, 0xde, 0x0, 0x0, 0x0, 0x0,
+		0x2, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+		0xac, 0x2,
+	}, data)
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+
+	h := uintptr(42)
+	data, err = Marshal(&h)
+	assert.NoError(t, err)
+	expected, err := Marshal(uint64(42))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, data)
+	var resh uintptr
+	assert.NoError(t, Unmarshal(data, &resh))
+	assert.Equal(t, h, resh)
+}
+
+type Base struct {
+	ID   uint32
+	Name string
+}
+
+type base struct {
+	ID      uint32
+	Name    string
+	private int
+}
+
+func TestEmbeddedStruct(t *testing.T) {
+	type S struct {
+		Base
+		Extra int8
+	}
+	s := S{Base: Base{ID: 7, Name: "x"}, Extra: -1}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x7, 0x0, 0x0, 0x0, 0x1, 'x', 0xff}, data)
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+}
+
+func TestEmbeddedUnexportedStruct(t *testing.T) {
+	type S struct {
+		base
+		Extra int8
+	}
+	s := S{base: base{ID: 7, Name: "x", private: 3}, Extra: -1}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x7, 0x0, 0x0, 0x0, 0x1, 'x', 0xff}, data)
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	s.private = 0
+	assert.Equal(t, s, res)
+
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+}
+
+func TestEmbeddedPointer(t *testing.T) {
+	type S struct {
+		*Base
+		Extra int8
+	}
+	s := S{Base: &Base{ID: 7, Name: "x"}, Extra: -1}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x1, 0x7, 0x0, 0x0, 0x0, 0x1, 'x', 0xff}, data)
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+
+	s = S{Extra: 2}
+	data, err = Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x0, 0x2}, data)
+	res = S{Base: &Base{ID: 1}}
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+}
+
+func TestMarshalBigEndian(t *testing.T) {
+	type S struct {
+		A uint32
+		B int16
+		C string
+	}
+	s := S{A: 0x01020304, B: -2, C: "x"}
+	data, err := MarshalBigEndian(s)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x1, 0x2, 0x3, 0x4, 0xff, 0xfe, 0x1, 'x'}, data)
+	little, err := Marshal(s)
+	assert.NoError(t, err)
+	assert.NotEqual(t, little, data)
+
+	var res S
+	assert.NoError(t, UnmarshalBigEndian(data, &res))
+	assert.Equal(t, s, res)
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, uint32(0x04030201), res.A)
+}
+
+func TestMapStructKeys(t *testing.T) {
+	type Point struct {
+		X, Y int16
+		Tag  string
+		_    int
+	}
+	type S struct {
+		Names map[Point]string
+		Sets  map[[2]Point]bool
+	}
+	s := S{
+		Names: map[Point]string{{X: 1, Y: 2}: "a", {X: -1, Tag: "b"}: "b", {}: ""},
+		Sets:  map[[2]Point]bool{{{X: 1}, {Y: 1}}: true},
+	}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+
+	enc := NewEncoder(new(bytes.Buffer))
+	enc.SortKeys = true
+	assert.EqualError(t, enc.Encode(s), "binary: field Names: cannot sort map keys of type binary.Point")
+}
+
+func TestDecodeEach(t *testing.T) {
+	type Record struct {
+		ID   uint16
+		Name string
+	}
+	records := []Record{{1, "one"}, {2, "two"}, {3, "three"}}
+	var data []byte
+	for _, r := range records {
+		var err error
+		data, err = MarshalAppend(data, r)
+		assert.NoError(t, err)
+	}
+
+	var r Record
+	var res []Record
+	err := NewDecoder(bytes.NewReader(data)).DecodeEach(&r, func() error {
+		res = append(res, r)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, records, res)
+
+	res = nil
+	err = NewDecoder(bytes.NewReader(data[:len(data)-2])).DecodeEach(&r, func() error {
+		res = append(res, r)
+		return nil
+	})
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, records[:2], res)
+
+	stop := errors.New("stop")
+	err = NewDecoder(bytes.NewReader(data)).DecodeEach(&r, func() error { return stop })
+	assert.Equal(t, stop, err)
+	assert.Equal(t, records[0], r)
+}
+
+func TestIntSize(t *testing.T) {
+	type S struct {
+		I  int
+		U  uint
+		Is []int
+	}
+	s := S{I: -2, U: 3, Is: []int{1}}
+	for _, test := range []struct {
+		size     int
+		expected []byte
+	}{
+		{0, []byte{
+			0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+			0x3, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+			0x1, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+		}},
+		{8, []byte{
+			0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+			0x3, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+			0x1, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+		}},
+		{4, []byte{0xfe, 0xff, 0xff, 0xff, 0x3, 0x0, 0x0, 0x0, 0x1, 0x1, 0x0, 0x0, 0x0}},
+	} {
+		t.Run(strconv.Itoa(test.size), func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			enc := NewEncoder(buf)
+			enc.IntSize = test.size
+			assert.NoError(t, enc.Encode(s))
+			assert.Equal(t, test.expected, buf.Bytes())
+
+			var res S
+			dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+			dec.IntSize = test.size
+			assert.NoError(t, dec.Decode(&res))
+			assert.Equal(t, s, res)
+
+			dec = NewDecoder(bytes.NewReader(buf.Bytes()))
+			dec.IntSize = test.size
+			assert.NoError(t, dec.Skip(&res))
+			assert.Equal(t, io.EOF, dec.Decode(&res))
+		})
+	}
+}
+
+func TestIntSizeOverflow(t *testing.T) {
+	enc := NewEncoder(new(bytes.Buffer))
+	enc.IntSize = 4
+	if strconv.IntSize == 64 {
+		// Converted at run time so that the test still builds where int is
+		// 32 bits wide and these values cannot occur.
+		big := int64(math.MaxInt32) + 1
+		assert.EqualError(t, enc.Encode(int(big)), "binary: int 2147483648 overflows IntSize 4")
+		assert.EqualError(t, enc.Encode(uint(big*2)), "binary: uint 4294967296 overflows IntSize 4")
+	}
+	assert.NoError(t, enc.Encode(math.MinInt32))
+
+	enc.IntSize = 2
+	assert.EqualError(t, enc.Encode(1), "binary: invalid IntSize 2")
+	dec := NewDecoder(bytes.NewReader([]byte{0x1, 0x0}))
+	dec.IntSize = 2
+	var i int
+	assert.EqualError(t, dec.Decode(&i), "binary: invalid IntSize 2")
+}
+
+func TestSliceOfMarshalers(t *testing.T) {
+	type S struct {
+		Binary []s2
+		Text   []textOnly
+		Array  [2]s2
+		Map    map[string]s2
+	}
+	s := S{
+		Binary: []s2{{[]byte{1}}, {[]byte{2}}},
+		Text:   []textOnly{{"a", "b"}, {"c", "d"}},
+		Array:  [2]s2{{[]byte{3}}, {[]byte{4}}},
+		Map:    map[string]s2{"x": {[]byte{5}}},
+	}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x2, 0x1, 0x1, 0x1, 0x2}, data[:5])
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+}
+
+func TestBufferedEncoder(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewBufferedEncoder(buf)
+	assert.NoError(t, enc.Encode(s1v))
+	assert.NoError(t, enc.Encode(s0v))
+	assert.Equal(t, 0, buf.Len())
+	assert.NoError(t, enc.Flush())
+	assert.Equal(t, append(append([]byte{}, svb...), s0b...), buf.Bytes())
+
+	// Unflushed output is discarded by Reset.
+	assert.NoError(t, enc.Encode(s0v))
+	other := new(bytes.Buffer)
+	enc.Reset(other)
+	assert.NoError(t, enc.Encode(s1v))
+	assert.NoError(t, enc.Flush())
+	assert.Equal(t, svb, other.Bytes())
+	assert.Equal(t, len(svb)+len(s0b), buf.Len())
+
+	// Flush is a no-op for unbuffered encoders.
+	buf.Reset()
+	enc = NewEncoder(buf)
+	assert.NoError(t, enc.Encode(s0v))
+	assert.Equal(t, s0b, buf.Bytes())
+	assert.NoError(t, enc.Flush())
+}
+
+func TestMergeMaps(t *testing.T) {
+	data, err := Marshal(map[string]int8{"new": 2, "both": 3})
+	assert.NoError(t, err)
+
+	m := map[string]int8{"old": 1, "both": 0}
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.MergeMaps = true
+	assert.NoError(t, dec.Decode(&m))
+	assert.Equal(t, map[string]int8{"old": 1, "new": 2, "both": 3}, m)
+
+	// A nil map is still allocated.
+	var nilMap map[string]int8
+	dec = NewDecoder(bytes.NewReader(data))
+	dec.MergeMaps = true
+	assert.NoError(t, dec.Decode(&nilMap))
+	assert.Equal(t, map[string]int8{"new": 2, "both": 3}, nilMap)
+
+	// Without MergeMaps the map is replaced.
+	m = map[string]int8{"old": 1}
+	assert.NoError(t, Unmarshal(data, &m))
+	assert.Equal(t, map[string]int8{"new": 2, "both": 3}, m)
+
+	// Merging a nil map leaves the destination untouched.
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.PreserveNil = true
+	assert.NoError(t, enc.Encode(map[string]int8(nil)))
+	m = map[string]int8{"old": 1}
+	dec = NewDecoder(buf)
+	dec.PreserveNil = true
+	dec.MergeMaps = true
+	assert.NoError(t, dec.Decode(&m))
+	assert.Equal(t, map[string]int8{"old": 1}, m)
+}
+
+func TestValidateUTF8(t *testing.T) {
+	type S struct {
+		Name string
+		Tags map[string]string
+	}
+	valid, err := Marshal(S{Name: "héllo, 世界", Tags: map[string]string{"ключ": "值"}})
+	assert.NoError(t, err)
+	invalid, err := Marshal(S{Name: "ok", Tags: map[string]string{"k": "bad\xff"}})
+	assert.NoError(t, err)
+
+	for _, zeroCopy := range []bool{false, true} {
+		dec := NewDecoder(bytes.NewBuffer(valid))
+		dec.SetZeroCopy(zeroCopy)
+		dec.SetValidateUTF8(true)
+		var res S
+		assert.NoError(t, dec.Decode(&res))
+		assert.Equal(t, "héllo, 世界", res.Name)
+
+		dec = NewDecoder(bytes.NewBuffer(invalid))
+		dec.SetZeroCopy(zeroCopy)
+		dec.SetValidateUTF8(true)
+		err = dec.Decode(&res)
+		assert.EqualError(t, err, "binary: field Tags[k]: invalid UTF-8 in string (after 0 of 1 map entries)")
+	}
+
+	// Validation is off by default.
+	var res S
+	assert.NoError(t, Unmarshal(invalid, &res))
+	assert.Equal(t, "bad\xff", res.Tags["k"])
+}
+
+func TestUnixNanoTag(t *testing.T) {
+	type S struct {
+		At   time.Time `binary:"unixnano"`
+		Full time.Time
+	}
+	at := time.Date(2021, 6, 7, 8, 9, 10, 11, time.UTC)
+	s := S{At: at, Full: at}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	full, err := at.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, 8+1+len(full), len(data))
+	assert.Equal(t, uint64(at.UnixNano()), binary.LittleEndian.Uint64(data))
+
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.True(t, at.Equal(res.At))
+	assert.Equal(t, time.Local, res.At.Location())
+	assert.Equal(t, s.Full, res.Full)
+
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+
+	type Bad struct {
+		At int64 `binary:"unixnano"`
+	}
+	_, err = Marshal(Bad{})
+	assert.EqualError(t, err, "binary: field At: unixnano tag on non-time.Time type int64")
+	assert.EqualError(t, Unmarshal(data, &Bad{}), "binary: field At: unixnano tag on non-time.Time type int64")
+}
+
+func TestDecodeInvalidTarget(t *testing.T) {
+	data := []byte{0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0}
+	var i int
+	assert.EqualError(t, Unmarshal(data, i), "binary: can only Decode to pointer type, not int")
+	assert.EqualError(t, Unmarshal(data, s0{}), "binary: can only Decode to pointer type, not binary.s0")
+	assert.EqualError(t, Unmarshal(data, (*int)(nil)), "binary: cannot Decode into nil pointer of type *int")
+	assert.EqualError(t, Unmarshal(data, nil), "binary: cannot Decode into nil")
+
+	// A settable value may be passed to DecodeValue directly.
+	assert.NoError(t, NewDecoder(bytes.NewReader(data)).DecodeValue(reflect.ValueOf(&i).Elem()))
+	assert.Equal(t, 1, i)
+}
+
+func TestNestedContainers(t *testing.T) {
+	type S struct {
+		Matrix [][]float64
+		Grid   [3][4]int
+		Maps   []map[string]int
+		Jagged [2][]int8
+	}
+	s := S{
+		Matrix: [][]float64{{1, 2}, {}, {3}},
+		Maps:   []map[string]int{{"a": 1}, {}},
+		Jagged: [2][]int8{{1}, {2, 3}},
+	}
+	for i := range s.Grid {
+		for j := range s.Grid[i] {
+			s.Grid[i][j] = i*4 + j
+		}
+	}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+
+	expected := new(bytes.Buffer)
+	expected.Write([]byte{0x3, 0x2})
+	assert.NoError(t, binary.Write(expected, binary.LittleEndian, []float64{1, 2}))
+	expected.Write([]byte{0x0, 0x1})
+	assert.NoError(t, binary.Write(expected, binary.LittleEndian, float64(3)))
+	for i := range s.Grid {
+		for j := range s.Grid[i] {
+			assert.NoError(t, binary.Write(expected, binary.LittleEndian, int64(s.Grid[i][j])))
+		}
+	}
+	expected.Write([]byte{0x2, 0x1, 0x1, 'a', 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0})
+	expected.Write([]byte{0x1, 0x1, 0x2, 0x2, 0x3})
+	assert.Equal(t, expected.Bytes(), data)
+
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+}
+
+func TestLengthEncoding(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		encoding LengthEncoding
+		order    binary.ByteOrder
+		expected []byte
+	}{
+		{"Varint", Varint, LittleEndian, []byte{0x2, 'h', 'i'}},
+		{"Fixed32", Fixed32, BigEndian, []byte{0x0, 0x0, 0x0, 0x2, 'h', 'i'}},
+		{"Fixed32LE", Fixed32, LittleEndian, []byte{0x2, 0x0, 0x0, 0x0, 'h', 'i'}},
+		{"Fixed64", Fixed64, BigEndian, []byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x2, 'h', 'i'}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			enc := NewEncoder(buf)
+			enc.Order = test.order
+			enc.LengthEncoding = test.encoding
+			assert.NoError(t, enc.Encode("hi"))
+			assert.Equal(t, test.expected, buf.Bytes())
+
+			s := struct {
+				Strings []string
+				Bytes   []byte
+				Map     map[string]int8
+				Nil     []int8
+				Text    textOnly
+			}{[]string{"a"}, []byte{1}, map[string]int8{"k": 1}, nil, textOnly{"x", "y"}}
+			enc.PreserveNil = true
+			assert.NoError(t, enc.Encode(s))
+
+			dec := NewDecoder(buf)
+			dec.Order = test.order
+			dec.LengthEncoding = test.encoding
+			var str string
+			assert.NoError(t, dec.Decode(&str))
+			assert.Equal(t, "hi", str)
+			res := s
+			res.Nil = []int8{}
+			dec.PreserveNil = true
+			assert.NoError(t, dec.Decode(&res))
+			assert.Equal(t, s, res)
+		})
+	}
+
+	enc := NewEncoder(new(bytes.Buffer))
+	enc.LengthEncoding = 3
+	assert.EqualError(t, enc.Encode("x"), "binary: invalid LengthEncoding 3")
+	dec := NewDecoder(bytes.NewReader([]byte{0x1, 'x'}))
+	dec.LengthEncoding = 3
+	var str string
+	assert.EqualError(t, dec.Decode(&str), "binary: invalid LengthEncoding 3")
+}
+
+func TestIncludeUnexported(t *testing.T) {
+	type S struct {
+		Public  string
+		private int16
+		ptr     *string
+		base
+	}
+	name := "name"
+	s := S{Public: "a", private: -2, ptr: &name, base: base{ID: 1, Name: "b", private: 3}}
+
+	// By default unexported fields are skipped.
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, S{Public: "a", base: base{ID: 1, Name: "b"}}, res)
+
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.IncludeUnexported = true
+	assert.NoError(t, enc.Encode(s))
+	assert.Equal(t, len(data)+2+1+5+8, buf.Len())
+
+	res = S{}
+	dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+	dec.IncludeUnexported = true
+	assert.NoError(t, dec.Decode(&res))
+	assert.Equal(t, s, res)
+
+	dec = NewDecoder(bytes.NewReader(buf.Bytes()))
+	dec.IncludeUnexported = true
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+
+	type private struct {
+		a int8
+	}
+	enc = NewStrictEncoder(new(bytes.Buffer))
+	assert.Error(t, enc.Encode(private{1}))
+	enc.IncludeUnexported = true
+	assert.NoError(t, enc.Encode(private{1}))
+}
+
+func TestMapOfByteSlices(t *testing.T) {
+	m := map[string][]byte{
+		"empty": {},
+		"small": {1, 2, 3},
+		"large": bytes.Repeat([]byte{0xab}, 100000),
+	}
+	data, err := Marshal(m)
+	assert.NoError(t, err)
+	var res map[string][]byte
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, m, res)
+
+	// Values must not share a backing array through the reused temporary.
+	res["small"][0] = 9
+	assert.Equal(t, byte(0xab), res["large"][0])
+}
+
+func TestUnmarshalN(t *testing.T) {
+	data := append(append([]byte{}, svb...), s0b...)
+	res1 := &s1{}
+	n, err := UnmarshalN(data, res1)
+	assert.NoError(t, err)
+	assert.Equal(t, len(svb), n)
+	assert.Equal(t, s1v, res1)
+
+	res0 := &s0{}
+	m, err := UnmarshalN(data[n:], res0)
+	assert.NoError(t, err)
+	assert.Equal(t, len(s0b), m)
+	assert.Equal(t, s0v, res0)
+
+	_, err = UnmarshalN(data[n+m:], res0)
+	assert.Equal(t, io.EOF, err)
+}
+
+type validated struct {
+	Count int32
+}
+
+func (v *validated) Validate() error {
+	if v.Count < 0 {
+		return fmt.Errorf("negative count %d", v.Count)
+	}
+	return nil
+}
+
+func TestValidator(t *testing.T) {
+	data, err := Marshal(validated{Count: 1})
+	assert.NoError(t, err)
+	var res validated
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, int32(1), res.Count)
+
+	data, err = Marshal(validated{Count: -1})
+	assert.NoError(t, err)
+	assert.EqualError(t, Unmarshal(data, &res), "negative count -1")
+
+	// Nested structs are validated too.
+	type Outer struct {
+		Items []validated
+	}
+	data, err = Marshal(Outer{Items: []validated{{1}, {-2}}})
+	assert.NoError(t, err)
+	assert.EqualError(t, Unmarshal(data, &Outer{}), "binary: field Items[1]: negative count -2")
+}
+
+func TestDecoderMaxBytes(t *testing.T) {
+	type S struct {
+		Names []string
+		Data  []byte
+	}
+	s := S{Names: []string{"a", "b"}, Data: bytes.Repeat([]byte{1}, 100)}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+
+	for _, zeroCopy := range []bool{false, true} {
+		dec := NewDecoder(bytes.NewBuffer(data))
+		dec.SetZeroCopy(zeroCopy)
+		dec.MaxBytes = len(data)
+		var res S
+		assert.NoError(t, dec.Decode(&res))
+		assert.Equal(t, s, res)
+
+		dec = NewDecoder(bytes.NewBuffer(data))
+		dec.SetZeroCopy(zeroCopy)
+		dec.MaxBytes = len(data) - 1
+		assert.EqualError(t, dec.Decode(&res), "binary: field Data: value exceeds MaxBytes")
+
+		dec = NewDecoder(bytes.NewBuffer(data))
+		dec.SetZeroCopy(zeroCopy)
+		dec.MaxBytes = 3
+		assert.EqualError(t, dec.Decode(&res), "binary: field Names[1]: value exceeds MaxBytes")
+
+		dec = NewDecoder(bytes.NewBuffer(data))
+		dec.SetZeroCopy(zeroCopy)
+		dec.MaxBytes = 10
+		assert.Error(t, dec.Skip(&res))
+	}
+
+	// The limit applies to each value separately.
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, enc.Encode(s))
+	}
+	dec := NewDecoder(buf)
+	dec.MaxBytes = len(data)
+	for i := 0; i < 3; i++ {
+		var res S
+		assert.NoError(t, dec.Decode(&res))
+	}
+}
+
+func TestDecodeArrayLenMismatch(t *testing.T) {
+	encode := func(v interface{}) []byte {
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(buf)
+		enc.ArrayLengths = true
+		assert.NoError(t, enc.Encode(v))
+		return buf.Bytes()
+	}
+	short := encode([2]int{1, 2})
+	long := encode([6]int{1, 2, 3, 4, 5, 6})
+
+	for _, test := range []struct {
+		policy    ArrayLenPolicy
+		shortErr  bool
+		longErr   bool
+		shortWant [4]int
+		longWant  [4]int
+	}{
+		{ArrayLenError, true, true, [4]int{}, [4]int{}},
+		{ArrayLenTruncate, true, false, [4]int{}, [4]int{1, 2, 3, 4}},
+		{ArrayLenPad, false, true, [4]int{1, 2}, [4]int{}},
+		{ArrayLenTruncate | ArrayLenPad, false, false, [4]int{1, 2}, [4]int{1, 2, 3, 4}},
+	} {
+		for _, c := range []struct {
+			data    []byte
+			wantErr bool
+			want    [4]int
+		}{
+			{short, test.shortErr, test.shortWant},
+			{long, test.longErr, test.longWant},
+		} {
+			// Trailing data checks that the whole array was consumed.
+			r := bytes.NewReader(append(append([]byte{}, c.data...), 0xff))
+			dec := NewDecoder(r)
+			dec.ArrayLengths = true
+			dec.ArrayLenMismatch = test.policy
+			res := [4]int{9, 9, 9, 9}
+			err := dec.Decode(&res)
+			if c.wantErr {
+				assert.Error(t, err)
+				continue
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.want, res)
+			assert.Equal(t, 1, r.Len())
+
+			r = bytes.NewReader(c.data)
+			dec = NewDecoder(r)
+			dec.ArrayLengths = true
+			dec.ArrayLenMismatch = test.policy
+			assert.NoError(t, dec.Skip(&res))
+			assert.Equal(t, 0, r.Len())
+		}
+	}
+
+	// Byte arrays take the same path.
+	dec := NewDecoder(bytes.NewReader(encode([6]byte{1, 2, 3, 4, 5, 6})))
+	dec.ArrayLengths = true
+	dec.ArrayLenMismatch = ArrayLenTruncate
+	var b [4]byte
+	assert.NoError(t, dec.Decode(&b))
+	assert.Equal(t, [4]byte{1, 2, 3, 4}, b)
+}
+
+func TestBytesBuffer(t *testing.T) {
+	type S struct {
+		Buf     bytes.Buffer
+		PBuf    *bytes.Buffer
+		Buffers map[string]bytes.Buffer
+		After   string
+	}
+	s := S{PBuf: bytes.NewBufferString("pointer"), Buffers: map[string]bytes.Buffer{"k": *bytes.NewBufferString("value")}, After: "after"}
+	s.Buf.WriteString("xxhello")
+	s.Buf.Next(2) // Only unread bytes are encoded.
+	data, err := Marshal(&s)
+	assert.NoError(t, err)
+	assert.Equal(t, append([]byte{5}, "hello"...), data[:6])
+
+	var res S
+	res.Buf.WriteString("stale")
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, "hello", res.Buf.String())
+	assert.Equal(t, "pointer", res.PBuf.String())
+	v := res.Buffers["k"]
+	assert.Equal(t, "value", v.String())
+	assert.Equal(t, "after", res.After)
+
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, int64(len(data)), dec.r.n)
+}
+
+func TestSliceOfPointers(t *testing.T) {
+	type Item struct {
+		Name string
+	}
+	a, b := &Item{"a"}, &Item{"b"}
+	pb := &b
+	type S struct {
+		Items  []*Item
+		Double []**Item
+		Array  [3]*Item
+		ByName map[string]*Item
+	}
+	s := S{
+		Items:  []*Item{a, nil, b, nil},
+		Double: []**Item{pb, nil, new(*Item)},
+		Array:  [3]*Item{nil, a, nil},
+		ByName: map[string]*Item{"a": a, "none": nil},
+	}
+	assert.NoError(t, Valid(s))
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+	assert.Nil(t, res.Items[1])
+	assert.Nil(t, res.Items[3])
+	assert.Nil(t, res.Double[1])
+	assert.NotNil(t, res.Double[2])
+	assert.Nil(t, *res.Double[2])
+	_, ok := res.ByName["none"]
+	assert.True(t, ok)
+
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, int64(len(data)), dec.r.n)
+
+	// A top-level slice of pointers.
+	items := []*Item{nil, a}
+	data, err = Marshal(items)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2, 0, 1, 1, 'a'}, data)
+	var resItems []*Item
+	assert.NoError(t, Unmarshal(data, &resItems))
+	assert.Equal(t, items, resItems)
+}
+
+func TestCanonicalNaN(t *testing.T) {
+	type S struct {
+		F64   float64
+		F32   float32
+		C128  complex128
+		Slice []float64
+	}
+	nans := []uint64{0x7ff8000000000001, 0x7ff0000000000001, 0xfff8000000000000, 0x7fffffffffffffff}
+	encode := func(canonical bool, bits uint64) []byte {
+		f := math.Float64frombits(bits)
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(buf)
+		enc.CanonicalNaN = canonical
+		assert.NoError(t, enc.Encode(S{f, float32(f), complex(f, f), []float64{f, 1}}))
+		return buf.Bytes()
+	}
+
+	distinct := map[string]bool{}
+	for _, bits := range nans {
+		distinct[string(encode(false, bits))] = true
+	}
+	assert.Equal(t, len(nans), len(distinct))
+
+	expected := encode(true, nans[0])
+	for _, bits := range nans {
+		assert.Equal(t, expected, encode(true, bits))
+	}
+	assert.Equal(t, uint64(canonicalNaN64), LittleEndian.Uint64(expected))
+	assert.Equal(t, uint32(canonicalNaN32), LittleEndian.Uint32(expected[8:]))
+
+	var res S
+	assert.NoError(t, Unmarshal(expected, &res))
+	assert.True(t, math.IsNaN(res.F64))
+	assert.True(t, math.IsNaN(float64(res.F32)))
+	assert.True(t, math.IsNaN(res.Slice[0]))
+	assert.Equal(t, 1.0, res.Slice[1])
+
+	// Other values are unaffected.
+	assert.Equal(t, encode(false, math.Float64bits(math.Inf(-1))), encode(true, math.Float64bits(math.Inf(-1))))
+}
+
+func TestDecoderAllowShortStruct(t *testing.T) {
+	type Old struct {
+		ID   uint32
+		Name string
+	}
+	type Inner struct {
+		A, B uint8
+	}
+	type New struct {
+		ID    uint32
+		Name  string
+		Email string
+		Inner Inner
+	}
+	data, err := Marshal(Old{ID: 7, Name: "bob"})
+	assert.NoError(t, err)
+
+	decode := func(data []byte, v interface{}) error {
+		dec := NewDecoder(bytes.NewReader(data))
+		dec.AllowShortStruct = true
+		return dec.Decode(v)
+	}
+	res := New{Email: "stale", Inner: Inner{1, 2}}
+	assert.Equal(t, io.ErrUnexpectedEOF, Unmarshal(data, &res))
+	res = New{Email: "stale", Inner: Inner{1, 2}}
+	assert.NoError(t, decode(data, &res))
+	assert.Equal(t, New{ID: 7, Name: "bob"}, res)
+
+	// Input ending within a field is still an error.
+	assert.Equal(t, io.ErrUnexpectedEOF, decode(data[:len(data)-1], &res))
+	assert.Equal(t, io.ErrUnexpectedEOF, decode(data[:2], &res))
+
+	// Nested structs may be short too.
+	full, err := Marshal(New{ID: 7, Name: "bob", Email: "e", Inner: Inner{1, 2}})
+	assert.NoError(t, err)
+	res = New{}
+	assert.NoError(t, decode(full[:len(full)-1], &res))
+	assert.Equal(t, New{ID: 7, Name: "bob", Email: "e", Inner: Inner{A: 1}}, res)
+
+	// Empty input is still the end of the stream.
+	assert.Equal(t, io.EOF, decode(nil, &res))
+}
+
+func TestDecodeCorruptMap(t *testing.T) {
+	type S struct {
+		Tags map[string]string
+		Next string
+	}
+	data, err := Marshal(S{Tags: map[string]string{"a": "1", "b": "2"}, Next: "\xff"})
+	assert.NoError(t, err)
+	// Claim a third entry, so that the decoder misreads the next field as
+	// its key.
+	assert.Equal(t, byte(2), data[0])
+	data[0] = 3
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.SetValidateUTF8(true)
+	var res S
+	err = dec.Decode(&res)
+	assert.EqualError(t, err, "binary: field Tags[2]: invalid UTF-8 in string (after 2 of 3 map entries)")
+	var fe *FieldError
+	assert.True(t, errors.As(err, &fe))
+	assert.Equal(t, errInvalidUTF8, errors.Unwrap(fe.Err))
+
+	// Running out of input is still reported as a bare io.ErrUnexpectedEOF,
+	// as Decode documents, rather than with the entry count. The entries
+	// read before the input ended are kept.
+	data = []byte{3, 1, 'a', 1, '1', 1, 'b', 1, '2', 1, 'c', 1, '3'}
+	for i := 1; i < len(data); i++ {
+		var m map[string]string
+		assert.Equal(t, io.ErrUnexpectedEOF, Unmarshal(data[:i], &m), "truncated at %d", i)
+		assert.Equal(t, (i-1)/4, len(m), "truncated at %d", i)
+	}
+
+	// Keys that are distinct when encoded may decode as equal, so repeated
+	// keys are accepted, with the last value winning.
+	var m map[uint8]bool
+	assert.NoError(t, Unmarshal([]byte{2, 1, 1, 1, 0}, &m))
+	assert.Equal(t, map[uint8]bool{1: false}, m)
+
+	type Key struct {
+		A    int8
+		Skip int8 `binary:"-"`
+	}
+	data, err = Marshal(map[Key]int{{1, 1}: 1, {1, 2}: 1})
+	assert.NoError(t, err)
+	var km map[Key]int
+	assert.NoError(t, Unmarshal(data, &km))
+	assert.Equal(t, map[Key]int{{1, 0}: 1}, km)
+
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	enc.UTC = true
+	assert.NoError(t, enc.Encode(map[time.Time]int{at: 1, at.In(time.FixedZone("X", 3600)): 1}))
+	var tm map[time.Time]int
+	assert.NoError(t, Unmarshal(buf.Bytes(), &tm))
+	assert.Equal(t, map[time.Time]int{at: 1}, tm)
+}
+
+func TestNamedByteSlices(t *testing.T) {
+	type rawBytes []byte
+	type S struct {
+		MAC    net.HardwareAddr
+		PMAC   *net.HardwareAddr
+		Raw    rawBytes
+		Plain  []byte
+		Macs   []net.HardwareAddr
+		ByName map[string]rawBytes
+	}
+	mac, err := net.ParseMAC("00:00:5e:00:53:01")
+	assert.NoError(t, err)
+	s := S{
+		MAC:    mac,
+		PMAC:   &mac,
+		Raw:    rawBytes("raw"),
+		Plain:  []byte("raw"),
+		Macs:   []net.HardwareAddr{mac, {}},
+		ByName: map[string]rawBytes{"k": rawBytes("v")},
+	}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	// Named byte slices are encoded exactly as []byte.
+	assert.Equal(t, []byte{6, 0x00, 0x00, 0x5e, 0x00, 0x53, 0x01}, data[:7])
+	assert.Equal(t, []byte{3, 'r', 'a', 'w', 3, 'r', 'a', 'w'}, data[15:23])
+
+	res := S{Raw: make(rawBytes, 0, 16)}
+	backing := res.Raw[:1]
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+	// The existing backing array is reused, as for []byte.
+	assert.Equal(t, byte('r'), backing[0])
+
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+}
+
+func TestFixedTag(t *testing.T) {
+	type Record struct {
+		Hash [32]byte `binary:"fixed=32"`
+		Salt []byte   `binary:"fixed=4"`
+		Name string
+	}
+	r := Record{Salt: []byte{9, 8, 7, 6}, Name: "x"}
+	for i := range r.Hash {
+		r.Hash[i] = byte(i)
+	}
+	data, err := Marshal(r)
+	assert.NoError(t, err)
+	assert.Equal(t, 32+4+1+1, len(data))
+	assert.Equal(t, r.Hash[:], data[:32])
+	assert.Equal(t, r.Salt, data[32:36])
+
+	// The tag also omits the length that ArrayLengths would add.
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	enc.ArrayLengths = true
+	assert.NoError(t, enc.Encode(r))
+	assert.Equal(t, data, buf.Bytes())
+
+	var res Record
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, r, res)
+
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+
+	r.Salt = []byte{1}
+	_, err = Marshal(r)
+	assert.EqualError(t, err, "binary: field Salt: 1 bytes do not match fixed=4 tag")
+
+	type BadLen struct {
+		Hash [16]byte `binary:"fixed=32"`
+	}
+	_, err = Marshal(BadLen{})
+	assert.EqualError(t, err, "binary: field Hash: fixed=32 tag on [16]uint8")
+	type BadType struct {
+		Hash string `binary:"fixed=32"`
+	}
+	assert.EqualError(t, Unmarshal(data, &BadType{}), "binary: field Hash: fixed tag on non-byte array or slice type string")
+	type BadN struct {
+		Hash []byte `binary:"fixed=x"`
+	}
+	assert.EqualError(t, Valid(BadN{}), "binary: field Hash: fixed tag without a positive length")
+}
+
+func TestEncodeToHash(t *testing.T) {
+	v := s1v
+	data, err := Marshal(v)
+	assert.NoError(t, err)
+	want := sha256.New()
+	want.Write(data)
+
+	h := sha256.New()
+	assert.NoError(t, NewEncoder(h).Encode(v))
+	assert.Equal(t, want.Sum(nil), h.Sum(nil))
+
+	h.Reset()
+	enc := NewBufferedEncoder(h)
+	assert.NoError(t, enc.Encode(v))
+	assert.NoError(t, enc.Flush())
+	assert.Equal(t, want.Sum(nil), h.Sum(nil))
+}
+
+func TestSliceOfStructPointersWithNil(t *testing.T) {
+	in := []*s0{{A: "a", B: "b", C: 1}, nil, {A: "c", C: -2}}
+	data, err := Marshal(in)
+	assert.NoError(t, err)
+
+	var out []*s0
+	assert.NoError(t, Unmarshal(data, &out))
+	assert.Equal(t, in, out)
+	assert.Nil(t, out[1])
+	// Each present element is freshly allocated rather than aliasing the input.
+	assert.True(t, in[0] != out[0])
+	assert.True(t, in[2] != out[2])
+
+	// Decoding over existing elements replaces the nil one and clears the
+	// one that is now nil.
+	out = []*s0{nil, {A: "old"}, nil}
+	assert.NoError(t, Unmarshal(data, &out))
+	assert.Equal(t, in, out)
+}
+
+func TestFloatSizes(t *testing.T) {
+	// float32 is always written in 4 bytes and float64 in 8, whatever the
+	// value, and a float32 round-trips exactly.
+	for _, f := range []float32{0, 1.1, math.MaxFloat32, float32(math.Inf(-1))} {
+		data, err := Marshal(f)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, len(data))
+		var res float32
+		assert.NoError(t, Unmarshal(data, &res))
+		assert.Equal(t, f, res)
+	}
+	data, err := Marshal(float64(1.1))
+	assert.NoError(t, err)
+	assert.Equal(t, 8, len(data))
+}
+
+func TestFloat32Tag(t *testing.T) {
+	type S struct {
+		F float64 `binary:"float32"`
+		N uint8
+	}
+	exact := S{F: 1.5, N: 1}
+	lossy := S{F: 1.1, N: 2}
+
+	enc := NewEncoder(&bytes.Buffer{})
+	enc.ExactFloat32 = true
+	assert.NoError(t, enc.Encode(exact))
+	assert.NoError(t, enc.Encode(S{F: math.NaN()}))
+	assert.NoError(t, enc.Encode(S{F: math.Inf(1)}))
+	assert.EqualError(t, enc.Encode(lossy), "binary: field F: 1.1 cannot be represented exactly as a float32")
+	assert.EqualError(t, enc.Encode(S{F: 1e300}), "binary: field F: 1e+300 cannot be represented exactly as a float32")
+
+	for _, s := range []S{exact, lossy} {
+		data, err := Marshal(s)
+		assert.NoError(t, err)
+		assert.Equal(t, 5, len(data))
+		var res S
+		assert.NoError(t, Unmarshal(data, &res))
+		assert.Equal(t, float64(float32(s.F)), res.F)
+		assert.Equal(t, s.N, res.N)
+
+		dec := NewDecoder(bytes.NewReader(data))
+		assert.NoError(t, dec.Skip(&res))
+		assert.Equal(t, io.EOF, dec.Decode(&res))
+	}
+
+	type Bad struct {
+		F float32 `binary:"float32"`
+	}
+	_, err := Marshal(Bad{})
+	assert.EqualError(t, err, "binary: field F: float32 tag on non-float64 type float32")
+	assert.EqualError(t, Valid(Bad{}), "binary: field F: float32 tag on non-float64 type float32")
+}
+
+func TestMapPointers(t *testing.T) {
+	type Item struct {
+		Name string
+	}
+	type S struct {
+		Counts  *map[string]int
+		NilMap  *map[string]int
+		ToNil   *map[string]int
+		ByName  map[string]*Item
+		ByIndex map[int]**Item
+	}
+	counts := map[string]int{"a": 1, "b": 2}
+	empty := map[string]int(nil)
+	item := &Item{"x"}
+	s := S{
+		Counts:  &counts,
+		ToNil:   &empty,
+		ByName:  map[string]*Item{"x": item, "none": nil},
+		ByIndex: map[int]**Item{1: &item, 2: nil},
+	}
+	assert.NoError(t, Valid(s))
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, counts, *res.Counts)
+	assert.Nil(t, res.NilMap)
+	// A pointer to a nil map decodes as a pointer to an empty map, as nil and
+	// empty maps are only distinguished with PreserveNil.
+	assert.NotNil(t, res.ToNil)
+	assert.Empty(t, *res.ToNil)
+	assert.Equal(t, s.ByName, res.ByName)
+	assert.True(t, res.ByName["x"] != item)
+	none, ok := res.ByName["none"]
+	assert.True(t, ok)
+	assert.Nil(t, none)
+	assert.Equal(t, "x", (**res.ByIndex[1]).Name)
+	assert.Nil(t, res.ByIndex[2])
+
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+
+	// A top-level pointer to a map, which like other pointers below the top
+	// level is written with a presence byte.
+	pm := &counts
+	data, err = Marshal(&pm)
+	assert.NoError(t, err)
+	var resCounts *map[string]int
+	assert.NoError(t, Unmarshal(data, &resCounts))
+	assert.Equal(t, counts, *resCounts)
+}
+
+func TestEncodeTimeUTC(t *testing.T) {
+	// An offset used by no real zone, so that it cannot match the local
+	// zone and decode as time.Local.
+	offset := -(4*60 + 17) * 60
+	loc := time.FixedZone("Nowhere", offset)
+	type S struct {
+		At    time.Time
+		Times []time.Time
+	}
+	at := time.Date(2020, 7, 1, 12, 0, 0, 0, loc)
+	s := S{At: at, Times: []time.Time{at}}
+
+	// By default the offset is kept but the named location is lost.
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.True(t, at.Equal(res.At))
+	name, resOffset := res.At.Zone()
+	assert.Equal(t, "", name)
+	assert.Equal(t, offset, resOffset)
+
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	enc.UTC = true
+	assert.NoError(t, enc.Encode(s))
+	assert.NoError(t, Unmarshal(buf.Bytes(), &res))
+	assert.Equal(t, at.UTC(), res.At)
+	assert.Equal(t, time.UTC, res.At.Location())
+	assert.Equal(t, []time.Time{at.UTC()}, res.Times)
+}
+
+func TestSliceHint(t *testing.T) {
+	data, err := Marshal([]int64{1, 2, 3})
+	assert.NoError(t, err)
+
+	dec := NewDecoder(bytes.NewReader(append(data, data...)))
+	dec.SliceHint(100)
+	var s []int64
+	assert.NoError(t, dec.Decode(&s))
+	assert.Equal(t, []int64{1, 2, 3}, s)
+	assert.Equal(t, 100, cap(s))
+	// The hint applies to one allocation only.
+	var s2 []int64
+	assert.NoError(t, dec.Decode(&s2))
+	assert.Equal(t, 3, cap(s2))
+
+	dec = NewDecoder(bytes.NewReader(data))
+	dec.MaxLen = 10
+	dec.SliceHint(100)
+	s = nil
+	assert.NoError(t, dec.Decode(&s))
+	assert.Equal(t, 10, cap(s))
+
+	dec = NewDecoder(bytes.NewReader(data))
+	dec.SliceHint(1)
+	s = nil
+	assert.NoError(t, dec.Decode(&s))
+	assert.Equal(t, 3, cap(s))
+
+	data, err = Marshal([]byte("abc"))
+	assert.NoError(t, err)
+	dec = NewDecoder(bytes.NewReader(data))
+	dec.SliceHint(64)
+	var b []byte
+	assert.NoError(t, dec.Decode(&b))
+	assert.Equal(t, []byte("abc"), b)
+	assert.Equal(t, 64, cap(b))
+}
+
+func TestDecodeUintOverflow(t *testing.T) {
+	// uint and uintptr are encoded in 8 bytes, so values above
+	// math.MaxUint32 only fit where the types are 64 bits wide.
+	x := uint64(math.MaxUint32 + 1)
+	data, err := Marshal(x)
+	assert.NoError(t, err)
+	var u uint
+	var p uintptr
+	if strconv.IntSize == 32 {
+		assert.EqualError(t, Unmarshal(data, &u), "binary: 4294967296 overflows uint")
+		assert.EqualError(t, Unmarshal(data, &p), "binary: 4294967296 overflows uintptr")
+	} else {
+		assert.NoError(t, Unmarshal(data, &u))
+		assert.Equal(t, x, uint64(u))
+		assert.NoError(t, Unmarshal(data, &p))
+		assert.Equal(t, x, uint64(p))
+	}
+
+	// With a 4-byte IntSize, a uint never overflows on decode.
+	dec := NewDecoder(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff}))
+	dec.IntSize = 4
+	assert.NoError(t, dec.Decode(&u))
+	assert.Equal(t, uint(math.MaxUint32), u)
+}
+
+func TestSizeHint(t *testing.T) {
+	type Celsius float32
+	for _, v := range []interface{}{
+		true, int8(-1), uint16(2), int32(3), 4, uint(5), uintptr(6), 7.5,
+		Celsius(8), complex64(9), complex(10, 11), time.Second,
+		[3]int16{1, 2, 3}, &[2][2]float64{}, []int64{}, make([]int64, 300),
+		[]byte("hello"), [][4]uint8{{1}, {2}}, []Celsius{1, 2},
+	} {
+		data, err := Marshal(v)
+		assert.NoError(t, err)
+		assert.Equal(t, len(data), sizeHint(v), "%T", v)
+	}
+	// Values whose size depends on their content are not sized up front.
+	for _, v := range []interface{}{
+		"str", []string{"a"}, struct{ A int32 }{1}, time.Time{}, []*int32{nil},
+		map[int8]int8{}, [][]int8{{1}}, (*int32)(nil), nil,
+	} {
+		assert.Equal(t, 0, sizeHint(v), "%T", v)
+	}
+}
+
+func BenchmarkEncodeStructI1(b *testing.B) {
+	type Struct struct {
+		S struct {
+			I int64
+		}
+	}
+	var s Struct
+	s.S.I = 1024
+	buf := new(bytes.Buffer)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		enc := NewEncoder(buf)
+		_ = enc.Encode(&s)
+	}
+
+}
+
+func BenchmarkEncodeStructI2(b *testing.B) {
+	type Struct struct {
+		S struct {
+			I int64
+		}
+	}
+	var s Struct
+	s.S.I = 1024
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = enc.Encode(&s)
+	}
+
+}
+
+func BenchmarkEncodeStructI3(b *testing.B) {
+	type Struct struct {
+		S struct {
+			I int64
+		}
+	}
+	var s Struct
+	s.S.I = 1024
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := enc.Encode(&s)
+		if err != nil {
+			b.Fatalf("error: %v\n", err)
+		}
+	}
+
+}
+
+func BenchmarkDecodeByteSlice(b *testing.B) {
+	data, err := Marshal(make([]byte, 1<<20))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(data)))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var out []byte
+		if err := Unmarshal(data, &out); err != nil {
+			b.Fatalf("error: %v\n", err)
+		}
+	}
+}
+
+func BenchmarkEncodeComplex(b *testing.B) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := enc.Encode(s1v); err != nil {
+			b.Fatalf("error: %v\n", err)
+		}
+	}
+}
+
+func BenchmarkDecodeComplex(b *testing.B) {
+	r := bytes.NewReader(svb)
+	dec := NewDecoder(r)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(svb)
+		var s s1
+		if err := dec.Decode(&s); err != nil {
+			b.Fatalf("error: %v\n", err)
+		}
+	}
+}
+
+func BenchmarkMarshalLargeSlice(b *testing.B) {
+	v := make([]string, 10000)
+	for i := range v {
+		v[i] = strconv.Itoa(i)
+	}
+	b.ReportAllocs()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(v); err != nil {
+			b.Fatalf("error: %v\n", err)
+		}
+	}
+}
+
+func benchmarkDecodeStrings(b *testing.B, zeroCopy bool) {
+	v := make([]string, 1000)
+	for i := range v {
+		v[i] = strings.Repeat("x", i%64)
+	}
+	data, err := Marshal(v)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dec := NewBytesDecoder(data)
+		dec.SetZeroCopy(zeroCopy)
+		var out []string
+		if err := dec.Decode(&out); err != nil {
+			b.Fatalf("error: %v\n", err)
+		}
+	}
+}
+
+func BenchmarkDecodeStringsCopy(b *testing.B)     { benchmarkDecodeStrings(b, false) }
+func BenchmarkDecodeStringsZeroCopy(b *testing.B) { benchmarkDecodeStrings(b, true) }
+
+func BenchmarkDecodeReusedSlice(b *testing.B) {
+	data, err := Marshal(make([]int32, 1000))
+	if err != nil {
+		b.Fatal(err)
+	}
+	r := bytes.NewReader(data)
+	dec := NewDecoder(r)
+	var out []int32
+	b.ReportAllocs()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(data)
+		if err := dec.Decode(&out); err != nil {
+			b.Fatalf("error: %v\n", err)
+		}
+	}
+}
+
+func BenchmarkEncodeByteArray(b *testing.B) {
+	var v [32]byte
+	enc := NewEncoder(io.Discard)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := enc.Encode(&v); err != nil {
+			b.Fatalf("error: %v\n", err)
+		}
+	}
+}
+
+func BenchmarkDecodeByteArray(b *testing.B) {
+	data := make([]byte, 32)
+	r := bytes.NewReader(data)
+	dec := NewDecoder(r)
+	var v [32]byte
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(data)
+		if err := dec.Decode(&v); err != nil {
+			b.Fatalf("error: %v\n", err)
+		}
+	}
+}
+
+func BenchmarkDecodeMap(b *testing.B) {
+	m := make(map[int32]int32, 10000)
+	for i := int32(0); i < 10000; i++ {
+		m[i] = i
+	}
+	data, err := Marshal(m)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var out map[int32]int32
+		if err := Unmarshal(data, &out); err != nil {
+			b.Fatalf("error: %v\n", err)
+		}
+	}
+}
+
+func BenchmarkEncodeInt64Slice(b *testing.B) {
+	s := make([]int64, 100000)
+	for i := range s {
+		s[i] = int64(i)
+	}
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	b.ReportAllocs()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := enc.Encode(s); err != nil {
+			b.Fatalf("error: %v\n", err)
+		}
+	}
+}
+
+func BenchmarkDecodeInt64Slice(b *testing.B) {
+	s := make([]int64, 100000)
+	for i := range s {
+		s[i] = int64(i)
+	}
+	data, err := Marshal(s)
+	if err != nil {
+		b.Fatal(err)
+	}
+	r := bytes.NewReader(data)
+	dec := NewDecoder(r)
+	var out []int64
+	b.ReportAllocs()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(data)
+		if err := dec.Decode(&out); err != nil {
+			b.Fatalf("error: %v\n", err)
+		}
+	}
+}
+
+func BenchmarkDecodeMapOfByteSlices(b *testing.B) {
+	m := make(map[string][]byte, 16)
+	for i := 0; i < 16; i++ {
+		m[strconv.Itoa(i)] = bytes.Repeat([]byte{byte(i)}, 64*1024)
+	}
+	data, err := Marshal(m)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var out map[string][]byte
+		if err := Unmarshal(data, &out); err != nil {
+			b.Fatalf("error: %v\n", err)
+		}
+	}
+}
+
+func BenchmarkEncodeInts(b *testing.B) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	b.ReportAllocs()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if i%1024 == 0 {
+			buf.Reset()
+		}
+		if err := enc.Encode(int64(i)); err != nil {
+			b.Fatalf("error: %v\n", err)
+		}
+	}
+}
+
+func BenchmarkEncodeByte(b *testing.B) {
+	enc := NewEncoder(io.Discard)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := enc.Encode(byte(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeByte(b *testing.B) {
+	dec := NewDecoder(&patternReader{})
+	var x byte
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := dec.Decode(&x); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkDecodeAppend(b *testing.B, hint int) {
+	data, err := Marshal(make([]int64, 64))
+	if err != nil {
+		b.Fatal(err)
+	}
+	r := bytes.NewReader(data)
+	dec := NewDecoder(r)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(data)
+		dec.SliceHint(hint)
+		var s []int64
+		if err := dec.Decode(&s); err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < 64; j++ {
+			s = append(s, int64(j))
+		}
+	}
+}
+
+func BenchmarkDecodeAppend(b *testing.B)          { benchmarkDecodeAppend(b, 0) }
+func BenchmarkDecodeAppendSliceHint(b *testing.B) { benchmarkDecodeAppend(b, 128) }
+
+type bufferT struct {
+	buf []byte
+}
+
+func (buf *bufferT) Read(data []byte) (int, error) {
+	n := copy(data, buf.buf)
+	if n != len(data) {
+		panic(fmt.Errorf("read too few bytes. got=%d want=%d", n, len(data)))
+	}
+	return n, nil
+}
+
+func getTestBuffer(b *testing.B) io.Reader {
+	return &bufferT{
+		buf: []byte{0, 4, 0, 0, 0, 0, 0, 0},
+	}
+}
+
+func BenchmarkDecodeStructI1(b *testing.B) {
+
+	type Struct struct {
+		I int64
+	}
+
+	var s Struct
+
+	buf := getTestBuffer(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dec := NewDecoder(buf)
+		_ = dec.Decode(&s)
+	}
+
+}
+
+func BenchmarkDecodeStructI2(b *testing.B) {
+
+	type Struct struct {
+		S struct {
+			I int64
+		}
+	}
+	var s Struct
+
+	buf := getTestBuffer(b)
+	dec := NewDecoder(buf)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = dec.Decode(&s)
+	}
+
+}
+
+func BenchmarkDecodeStructI3(b *testing.B) {
+
+	type Struct struct {
+		S struct {
+			I int64
+		}
+	}
+	var s Struct
+
+	buf := getTestBuffer(b)
+	dec := NewDecoder(buf)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := dec.Decode(&s)
+		if err != nil {
+			b.Fatalf("error: %v\n", err)
+		}
+	}
+
+}
+
+func BenchmarkMarshalLargeFixedSlice(b *testing.B) {
+	v := make([]int64, 10000)
+	for i := range v {
+		v[i] = int64(i)
+	}
+	b.ReportAllocs()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(v); err != nil {
+			b.Fatalf("error: %v\n", err)
+		}
+	}
 }
@@ -0,0 +1,90 @@
+package binary
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+// Blob is a byte payload of known length that is streamed from R when it is
+// encoded, rather than held in memory. It is encoded like a []byte of length
+// Len, so it can be decoded as one. R must yield at least Len bytes. With
+// PreserveNil, the zero Blob is encoded like a nil []byte.
+//
+// Decoding into a Blob reads the whole payload into memory, subject to MaxLen.
+// A nil []byte decodes as the zero Blob when PreserveNil is set.
+// To stream a payload out again, use Decoder.DecodeBlob instead.
+type Blob struct {
+	R   io.Reader
+	Len int64
+}
+
+var blobType = reflect.TypeOf(Blob{})
+
+// encodeBlob writes the length of the Blob rv followed by its payload.
+func (b *Encoder) encodeBlob(rv reflect.Value) error {
+	blob := rv.Interface().(Blob)
+	if blob.Len < 0 || blob.Len > math.MaxInt {
+		return fmt.Errorf("binary: invalid Blob length %d", blob.Len)
+	}
+	if err := b.writeSliceLen(blob.R == nil && blob.Len == 0, int(blob.Len)); err != nil {
+		return err
+	}
+	if c, ok := b.w.(*countingWriter); ok {
+		// Size counts the payload without consuming it.
+		c.n += int(blob.Len)
+		return nil
+	}
+	if blob.Len == 0 {
+		return nil
+	}
+	if blob.R == nil {
+		return errors.New("binary: Blob has no reader")
+	}
+	if _, err := io.CopyN(b.w, blob.R, blob.Len); err == io.EOF {
+		return fmt.Errorf("binary: Blob reader ended before %d bytes", blob.Len)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// decodeBlob reads a payload into memory as a Blob.
+func (d *Decoder) decodeBlob(rv reflect.Value) error {
+	l, isNil, err := d.readSliceLen()
+	if err != nil {
+		return err
+	}
+	if isNil {
+		rv.Set(reflect.Zero(blobType))
+		return nil
+	}
+	buf := make([]byte, l)
+	if _, err = io.ReadFull(d.r, buf); err != nil {
+		return err
+	}
+	rv.Set(reflect.ValueOf(Blob{R: bytes.NewReader(buf), Len: int64(len(buf))}))
+	return nil
+}
+
+// DecodeBlob reads the length prefix of a Blob or []byte, and returns a
+// reader over the payload that follows, without reading the payload itself.
+// The reader must be read to the end before anything else is decoded. As
+// nothing is allocated for the payload, its length is not checked against
+// MaxLen. A nil payload written with PreserveNil yields an empty reader.
+func (d *Decoder) DecodeBlob() (*io.LimitedReader, error) {
+	l, err := d.readLenPrefix()
+	if err != nil {
+		return nil, err
+	}
+	if d.PreserveNil && l > 0 {
+		l--
+	}
+	if l > math.MaxInt64 {
+		return nil, fmt.Errorf("binary: length %d overflows int64", l)
+	}
+	return &io.LimitedReader{R: d.r, N: int64(l)}, nil
+}
@@ -0,0 +1,154 @@
+package binary
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// patternReader yields an endless repeating byte pattern.
+type patternReader struct{ i int }
+
+func (p *patternReader) Read(b []byte) (int, error) {
+	for j := range b {
+		b[j] = byte(p.i % 251)
+		p.i++
+	}
+	return len(b), nil
+}
+
+func TestBlobStreaming(t *testing.T) {
+	const size = 10 << 20
+	want := sha256.New()
+	_, err := io.CopyN(want, &patternReader{}, size)
+	assert.NoError(t, err)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	r, w := io.Pipe()
+	go func() {
+		enc := NewEncoder(w)
+		err := enc.Encode(Blob{R: &patternReader{}, Len: size})
+		if err == nil {
+			err = enc.Encode("after")
+		}
+		w.CloseWithError(err)
+	}()
+	dec := NewDecoder(r)
+	payload, err := dec.DecodeBlob()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(size), payload.N)
+	got := sha256.New()
+	n, err := io.Copy(got, payload)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(size), n)
+	var s string
+	assert.NoError(t, dec.Decode(&s))
+	assert.Equal(t, "after", s)
+
+	runtime.ReadMemStats(&after)
+	assert.Equal(t, want.Sum(nil), got.Sum(nil))
+	allocated := after.TotalAlloc - before.TotalAlloc
+	assert.True(t, allocated < size/10, "allocated %d bytes streaming %d", allocated, size)
+}
+
+func TestBlob(t *testing.T) {
+	type S struct {
+		Data Blob
+		Tail string
+	}
+	data, err := Marshal(S{Data: Blob{R: strings.NewReader("payload and more"), Len: 7}, Tail: "t"})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{7, 'p', 'a', 'y', 'l', 'o', 'a', 'd', 1, 't'}, data)
+
+	// Blobs are encoded as []byte.
+	var asBytes struct {
+		Data []byte
+		Tail string
+	}
+	assert.NoError(t, Unmarshal(data, &asBytes))
+	assert.Equal(t, []byte("payload"), asBytes.Data)
+
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, int64(7), res.Data.Len)
+	b, err := io.ReadAll(res.Data.R)
+	assert.NoError(t, err)
+	assert.Equal(t, "payload", string(b))
+	assert.Equal(t, "t", res.Tail)
+
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+
+	n, err := Size(Blob{R: strings.NewReader("unread"), Len: 1 << 30})
+	assert.NoError(t, err)
+	assert.Equal(t, 5+1<<30, n)
+
+	_, err = Marshal(Blob{R: strings.NewReader("short"), Len: 10})
+	assert.EqualError(t, err, "binary: Blob reader ended before 10 bytes")
+	_, err = Marshal(Blob{Len: 1})
+	assert.EqualError(t, err, "binary: Blob has no reader")
+	data, err = Marshal(Blob{})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0}, data)
+}
+
+func TestBlobPreserveNil(t *testing.T) {
+	type S struct {
+		Nil   Blob
+		Empty Blob
+		Data  Blob
+	}
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.PreserveNil = true
+	assert.NoError(t, enc.Encode(S{
+		Empty: Blob{R: strings.NewReader("")},
+		Data:  Blob{R: strings.NewReader("ab"), Len: 2},
+	}))
+	data := buf.Bytes()
+	assert.Equal(t, []byte{0, 1, 3, 'a', 'b'}, data)
+
+	// Blobs are encoded as []byte, nil included.
+	var asBytes struct{ Nil, Empty, Data []byte }
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.PreserveNil = true
+	assert.NoError(t, dec.Decode(&asBytes))
+	assert.Nil(t, asBytes.Nil)
+	assert.Equal(t, []byte{}, asBytes.Empty)
+	assert.Equal(t, []byte("ab"), asBytes.Data)
+
+	var res S
+	dec = NewDecoder(bytes.NewReader(data))
+	dec.PreserveNil = true
+	assert.NoError(t, dec.Decode(&res))
+	assert.Equal(t, Blob{}, res.Nil)
+	assert.NotNil(t, res.Empty.R)
+	assert.Equal(t, int64(0), res.Empty.Len)
+	b, err := io.ReadAll(res.Data.R)
+	assert.NoError(t, err)
+	assert.Equal(t, "ab", string(b))
+
+	dec = NewDecoder(bytes.NewReader(data))
+	dec.PreserveNil = true
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+
+	dec = NewDecoder(bytes.NewReader(data))
+	dec.PreserveNil = true
+	for _, want := range []string{"", "", "ab"} {
+		payload, err := dec.DecodeBlob()
+		assert.NoError(t, err)
+		b, err := io.ReadAll(payload)
+		assert.NoError(t, err)
+		assert.Equal(t, want, string(b))
+	}
+}
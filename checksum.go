@@ -0,0 +1,43 @@
+package binary
+
+import (
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// ErrChecksum is returned by DecodeChecksummed when a value does not match
+// its checksum.
+var ErrChecksum = errors.New("binary: checksum mismatch")
+
+// EncodeChecksummed writes v followed by a CRC-32 (IEEE) checksum of its
+// encoding.
+func (b *Encoder) EncodeChecksummed(v interface{}) error {
+	h := crc32.NewIEEE()
+	enc := *b
+	enc.w = io.MultiWriter(b.w, h)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return b.Encode(h.Sum32())
+}
+
+// DecodeChecksummed reads a value written by EncodeChecksummed into v,
+// returning ErrChecksum if the checksum does not match.
+func (d *Decoder) DecodeChecksummed(v interface{}) error {
+	start := d.r.n
+	h := crc32.NewIEEE()
+	cd := *d
+	cd.r = &byteReader{Reader: io.TeeReader(d.r, h)}
+	if err := cd.Decode(v); err != nil {
+		return err
+	}
+	var sum uint32
+	if err := d.Decode(&sum); err != nil {
+		return d.unexpectedEOF(start, err)
+	}
+	if sum != h.Sum32() {
+		return ErrChecksum
+	}
+	return nil
+}
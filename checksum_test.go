@@ -0,0 +1,49 @@
+package binary
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksummed(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	assert.NoError(t, enc.EncodeChecksummed(s1v))
+	assert.NoError(t, enc.EncodeChecksummed("next"))
+	sum := make([]byte, 4)
+	binary.LittleEndian.PutUint32(sum, crc32.ChecksumIEEE(svb))
+	assert.Equal(t, append(append([]byte{}, svb...), sum...), buf.Bytes()[:len(svb)+4])
+
+	dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+	res := &s1{}
+	assert.NoError(t, dec.DecodeChecksummed(res))
+	assert.Equal(t, s1v, res)
+	var s string
+	assert.NoError(t, dec.DecodeChecksummed(&s))
+	assert.Equal(t, "next", s)
+	assert.Equal(t, io.EOF, dec.DecodeChecksummed(&s))
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	buf := new(bytes.Buffer)
+	assert.NoError(t, NewEncoder(buf).EncodeChecksummed(s1v))
+	data := buf.Bytes()
+	data[3] ^= 0x10
+
+	err := NewDecoder(bytes.NewReader(data)).DecodeChecksummed(&s1{})
+	assert.Equal(t, ErrChecksum, err)
+}
+
+func TestChecksumTruncated(t *testing.T) {
+	buf := new(bytes.Buffer)
+	assert.NoError(t, NewEncoder(buf).EncodeChecksummed(s1v))
+	data := buf.Bytes()
+
+	err := NewDecoder(bytes.NewReader(data[:len(svb)])).DecodeChecksummed(&s1{})
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
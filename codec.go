@@ -0,0 +1,92 @@
+package binary
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+type codec struct {
+	enc func(*Encoder, reflect.Value) error
+	dec func(*Decoder, reflect.Value) error
+}
+
+var (
+	codecs    sync.Map // map[reflect.Type]codec
+	hasCodecs int32    // set to 1 once any codec is registered
+)
+
+// RegisterCodec registers functions to encode and decode values of type t,
+// replacing any previously registered for it. They take precedence over all
+// other encodings of t, including its BinaryMarshaler or TextMarshaler
+// methods, and apply to t wherever it appears, such as in slice elements. The
+// one exception is a codec for byte, as []byte, net.IP and RawValue are
+// always written as raw bytes. dec is passed an addressable value to decode into, and must
+// read exactly what enc writes.
+func RegisterCodec(t reflect.Type, enc func(*Encoder, reflect.Value) error, dec func(*Decoder, reflect.Value) error) {
+	if enc == nil || dec == nil {
+		panic("binary: RegisterCodec requires both encode and decode functions")
+	}
+	codecs.Store(t, codec{enc: enc, dec: dec})
+	atomic.StoreInt32(&hasCodecs, 1)
+}
+
+// lookupCodec returns the codec registered for t, if any.
+func lookupCodec(t reflect.Type) (codec, bool) {
+	if atomic.LoadInt32(&hasCodecs) == 0 {
+		return codec{}, false
+	}
+	c, ok := codecs.Load(t)
+	if !ok {
+		return codec{}, false
+	}
+	return c.(codec), true
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// RegisterErrorCodec registers a codec for the error interface type, so that
+// struct fields and other values of type error can be encoded. An error is
+// written as a presence byte followed, if it is not nil, by the string
+// returned by its Error method, and is decoded as an error created by
+// errors.New with that string. This is lossy: the decoded error has neither
+// the type of the original nor anything it wrapped, so errors.Is and
+// errors.As will not match it as they did the original.
+func RegisterErrorCodec() {
+	RegisterCodec(errorType, encodeError, decodeError)
+}
+
+func encodeError(e *Encoder, rv reflect.Value) error {
+	if rv.IsNil() {
+		_, err := e.w.Write([]byte{0})
+		return err
+	}
+	if _, err := e.w.Write([]byte{1}); err != nil {
+		return err
+	}
+	msg := rv.Interface().(error).Error()
+	if err := e.writeLen(len(msg)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(e.w, msg)
+	return err
+}
+
+func decodeError(d *Decoder, rv reflect.Value) error {
+	present, err := d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if present == 0 {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+	msg, err := d.readString()
+	if err != nil {
+		return err
+	}
+	rv.Set(reflect.ValueOf(errors.New(msg)))
+	return nil
+}
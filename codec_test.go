@@ -0,0 +1,184 @@
+package binary
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func registerUnixNanoCodec(t *testing.T) {
+	RegisterCodec(timeType,
+		func(e *Encoder, rv reflect.Value) error {
+			return e.Encode(rv.Interface().(time.Time).UnixNano())
+		},
+		func(d *Decoder, rv reflect.Value) error {
+			var n int64
+			if err := d.Decode(&n); err != nil {
+				return err
+			}
+			rv.Set(reflect.ValueOf(time.Unix(0, n).UTC()))
+			return nil
+		})
+	t.Cleanup(func() { codecs.Delete(timeType) })
+}
+
+func TestRegisterCodec(t *testing.T) {
+	registerUnixNanoCodec(t)
+	type S struct {
+		At    time.Time
+		Times []time.Time
+	}
+	at := time.Date(2021, 6, 7, 8, 9, 10, 11, time.UTC)
+	s := S{At: at, Times: []time.Time{at.Add(time.Hour)}}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, 8+1+8, len(data))
+
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+
+	assert.Equal(t, io.ErrUnexpectedEOF, Unmarshal(data[:4], &res))
+}
+
+func TestRegisterCodecNil(t *testing.T) {
+	assert.Panics(t, func() { RegisterCodec(timeType, nil, nil) })
+}
+
+func TestRegisterErrorCodec(t *testing.T) {
+	type Event struct {
+		Name   string
+		Err    error
+		Causes []error
+	}
+	e := Event{Name: "write", Err: fmt.Errorf("saving: %w", io.ErrShortWrite), Causes: []error{nil, io.EOF}}
+	_, err := Marshal(e)
+	assert.EqualError(t, err, "binary: field Err: type not registered for interface: *fmt.wrapError")
+
+	RegisterErrorCodec()
+	t.Cleanup(func() { codecs.Delete(errorType) })
+	assert.NoError(t, Valid(e))
+	data, err := Marshal(e)
+	assert.NoError(t, err)
+
+	var res Event
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, "write", res.Name)
+	assert.EqualError(t, res.Err, "saving: short write")
+	assert.Equal(t, 2, len(res.Causes))
+	assert.Nil(t, res.Causes[0])
+	assert.EqualError(t, res.Causes[1], "EOF")
+
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+}
+
+type wideByte uint8
+
+func TestRegisterCodecElements(t *testing.T) {
+	// Slice and array elements with a codec bypass the fast paths.
+	int64Codec := func(e *Encoder, rv reflect.Value) error {
+		_, err := e.w.Write(binary.AppendVarint(nil, rv.Int()))
+		return err
+	}
+	RegisterCodec(int64Type, int64Codec, func(d *Decoder, rv reflect.Value) error {
+		n, err := d.readSvarint()
+		rv.SetInt(n)
+		return err
+	})
+	t.Cleanup(func() { codecs.Delete(int64Type) })
+	wideType := reflect.TypeOf(wideByte(0))
+	RegisterCodec(wideType,
+		func(e *Encoder, rv reflect.Value) error {
+			_, err := e.w.Write([]byte{0, byte(rv.Uint())})
+			return err
+		},
+		func(d *Decoder, rv reflect.Value) error {
+			var buf [2]byte
+			_, err := io.ReadFull(d.r, buf[:])
+			rv.SetUint(uint64(buf[1]))
+			return err
+		})
+	t.Cleanup(func() { codecs.Delete(wideType) })
+
+	type S struct {
+		Ints  []int64
+		Wide  []wideByte
+		Array [2]wideByte
+	}
+	s := S{Ints: []int64{1, -1, 300}, Wide: []wideByte{7}, Array: [2]wideByte{8, 9}}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{3, 0x02, 0x01, 0xd8, 0x04, 1, 0, 7, 0, 8, 0, 9}, data)
+
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+}
+
+type codecPoint struct{ X int32 }
+
+func TestRegisterCodecPointer(t *testing.T) {
+	// A codec for a pointer type applies to fields, elements and interface
+	// values of that type alike, and replaces the presence byte.
+	ptrType := reflect.TypeOf((*codecPoint)(nil))
+	RegisterCodec(ptrType,
+		func(e *Encoder, rv reflect.Value) error {
+			c := byte(0)
+			if !rv.IsNil() {
+				c = byte(rv.Elem().Field(0).Int()) + 1
+			}
+			_, err := e.w.Write([]byte{c})
+			return err
+		},
+		func(d *Decoder, rv reflect.Value) error {
+			c, err := d.r.ReadByte()
+			if err != nil || c == 0 {
+				rv.Set(reflect.Zero(rv.Type()))
+				return err
+			}
+			rv.Set(reflect.ValueOf(&codecPoint{X: int32(c) - 1}))
+			return nil
+		})
+	t.Cleanup(func() { codecs.Delete(ptrType) })
+	RegisterName("codecPoint", &codecPoint{})
+
+	type S struct {
+		Field  *codecPoint
+		Nil    *codecPoint
+		Double **codecPoint
+		Elems  []*codecPoint
+		Any    interface{}
+	}
+	p := &codecPoint{X: 0xaa}
+	s := S{Field: p, Double: &p, Elems: []*codecPoint{p}, Any: p}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xab, 0, 1, 0xab, 1, 0xab, 10, 'c', 'o', 'd', 'e', 'c', 'P', 'o', 'i', 'n', 't', 0xab}, data)
+
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+
+	type Unsupported struct{ C chan int }
+	RegisterCodec(reflect.TypeOf((*Unsupported)(nil)), func(*Encoder, reflect.Value) error { return nil }, func(*Decoder, reflect.Value) error { return nil })
+	t.Cleanup(func() { codecs.Delete(reflect.TypeOf((*Unsupported)(nil))) })
+	assert.NoError(t, Valid(struct{ U *Unsupported }{}))
+}
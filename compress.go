@@ -0,0 +1,41 @@
+package binary
+
+import (
+	"compress/flate"
+	"io"
+)
+
+// NewCompressingEncoder creates an encoder similar to NewEncoder that
+// compresses its output with DEFLATE at the given level, which is one of the
+// levels accepted by flate.NewWriter. Values are encoded exactly as by
+// NewEncoder before being compressed. Close must be called once all values
+// have been encoded to write out the end of the compressed stream.
+func NewCompressingEncoder(w io.Writer, level int) (*Encoder, error) {
+	fw, err := flate.NewWriter(w, level)
+	if err != nil {
+		return nil, err
+	}
+	e := NewEncoder(fw)
+	e.fw = fw
+	return e, nil
+}
+
+// Close flushes any buffered output and, for an encoder created by
+// NewCompressingEncoder, ends the compressed stream. It does not close the
+// underlying writer.
+func (e *Encoder) Close() error {
+	if e.fw != nil {
+		return e.fw.Close()
+	}
+	return e.Flush()
+}
+
+// NewDecompressingDecoder creates a decoder similar to NewDecoder that reads
+// values from the output of an encoder created by NewCompressingEncoder.
+// Unlike NewDecoder, it may read past the end of the compressed stream in r.
+func NewDecompressingDecoder(r io.Reader) *Decoder {
+	fr := flate.NewReader(r)
+	d := NewDecoder(fr)
+	d.fr = fr
+	return d
+}
@@ -0,0 +1,69 @@
+package binary
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressed(t *testing.T) {
+	type S struct {
+		Names []string
+		Data  []uint64
+	}
+	s := S{Names: make([]string, 100), Data: make([]uint64, 1000)}
+	for i := range s.Names {
+		s.Names[i] = strings.Repeat("name", 10)
+	}
+	plain, err := Marshal(s)
+	assert.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	enc, err := NewCompressingEncoder(buf, flate.BestCompression)
+	assert.NoError(t, err)
+	assert.NoError(t, enc.Encode(s))
+	assert.NoError(t, enc.Encode("next"))
+	assert.NoError(t, enc.Close())
+	assert.True(t, buf.Len() < len(plain)/10, "compressed %d bytes to %d", len(plain), buf.Len())
+
+	dec := NewDecompressingDecoder(bytes.NewReader(buf.Bytes()))
+	var res S
+	assert.NoError(t, dec.Decode(&res))
+	assert.Equal(t, s, res)
+	var str string
+	assert.NoError(t, dec.Decode(&str))
+	assert.Equal(t, "next", str)
+	assert.Equal(t, io.EOF, dec.Decode(&str))
+
+	// Both ends can be reused on a new stream.
+	buf2 := new(bytes.Buffer)
+	enc.Reset(buf2)
+	assert.NoError(t, enc.Encode("again"))
+	assert.NoError(t, enc.Close())
+	dec.Reset(buf2)
+	assert.NoError(t, dec.Decode(&str))
+	assert.Equal(t, "again", str)
+}
+
+func TestCompressedFlush(t *testing.T) {
+	r, w := io.Pipe()
+	enc, err := NewCompressingEncoder(w, flate.DefaultCompression)
+	assert.NoError(t, err)
+	go func() {
+		_ = enc.Encode("first")
+		_ = enc.Flush()
+	}()
+	// Flush makes the value readable before the stream is closed.
+	var str string
+	assert.NoError(t, NewDecompressingDecoder(r).Decode(&str))
+	assert.Equal(t, "first", str)
+}
+
+func TestCompressingEncoderBadLevel(t *testing.T) {
+	_, err := NewCompressingEncoder(io.Discard, 42)
+	assert.Error(t, err)
+}
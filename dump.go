@@ -0,0 +1,130 @@
+package binary
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"text/tabwriter"
+)
+
+// dumpHexLimit is the number of bytes of a value shown in full by Dump.
+const dumpHexLimit = 16
+
+// Dump decodes b as a value of the type of proto, or of the type it points
+// to, and returns an annotated listing of the encoding for debugging. Each
+// line gives the byte range of a value, its name, its bytes in hex and the
+// decoded value. Structs are broken down field by field, with nested fields
+// named by their path such as "Inner.X", unless they are encoded as a whole,
+// such as through a marshaler or in tagged form. Any bytes left over are
+// listed as trailing.
+//
+// If decoding fails, Dump returns the listing up to the failure along with
+// the error, as Decode would report it.
+func Dump(b []byte, proto interface{}) (listing string, err error) {
+	t := reflect.TypeOf(proto)
+	if t == nil {
+		return "", errors.New("binary: cannot Dump without a prototype")
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	d := NewDecoder(bytes.NewReader(b))
+	out := &bytes.Buffer{}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer func() {
+		w.Flush()
+		listing = out.String()
+	}()
+	defer recoverPanic(&err)
+	err = d.dump(w, b, "", t, func(v reflect.Value) error { return d.decodeValue(v) })
+	if n := int(d.r.n); err == nil && n < len(b) {
+		dumpLine(w, b, n, len(b), "(trailing)", "")
+	}
+	return "", d.unexpectedEOF(0, err)
+}
+
+// dump decodes a value of type t with decode and writes a line for it to w,
+// or one for each of its fields if it is a struct that is encoded field by
+// field. The value is named by its path, or by its type at the top level.
+func (d *Decoder) dump(w io.Writer, b []byte, path string, t reflect.Type, decode func(v reflect.Value) error) error {
+	if !dumpsFields(t) {
+		name := path
+		if name == "" {
+			name = t.String()
+		}
+		start := int(d.r.n)
+		v := reflect.New(t).Elem()
+		err := decode(v)
+		if err != nil {
+			return err
+		}
+		value := fmt.Sprintf("%v", v)
+		if v.Kind() == reflect.String {
+			value = fmt.Sprintf("%q", v)
+		}
+		dumpLine(w, b, start, int(d.r.n), name, value)
+		return nil
+	}
+	for _, f := range structFields(t) {
+		if f.unexported {
+			continue
+		}
+		f := f
+		ft := t.Field(f.index).Type
+		fpath := f.name
+		if f.inline {
+			fpath = path
+		} else if path != "" {
+			fpath = path + "." + f.name
+		}
+		if err := d.dump(w, b, fpath, ft, func(v reflect.Value) error { return d.decodeField(f, v) }); err != nil {
+			if f.inline {
+				return err
+			}
+			return withField(err, f.name)
+		}
+	}
+	return nil
+}
+
+// dumpsFields reports whether Dump lists the fields of values of type t
+// separately, which it does for structs that are encoded as a plain sequence
+// of fields.
+func dumpsFields(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || nullTypes[t] {
+		return false
+	}
+	if _, ok := lookupCodec(t); ok {
+		return false
+	}
+	switch t {
+	case blobType, bufferType, syncMapType:
+		return false
+	}
+	if pt := reflect.PtrTo(t); pt.Implements(binaryUnmarshalerType) || pt.Implements(textUnmarshalerType) {
+		return false
+	}
+	fields := structFields(t)
+	if isTagged(fields) || isNamed(fields) {
+		return false
+	}
+	for _, f := range fields {
+		if f.optional {
+			return false
+		}
+	}
+	return true
+}
+
+// dumpLine writes a line of a Dump listing for the bytes of b from start to
+// end.
+func dumpLine(w io.Writer, b []byte, start, end int, name, value string) {
+	raw := b[start:end]
+	hex := fmt.Sprintf("% x", raw)
+	if len(raw) > dumpHexLimit {
+		hex = fmt.Sprintf("% x ...", raw[:dumpHexLimit])
+	}
+	fmt.Fprintf(w, "%04x-%04x\t%s\t%s\t%s\n", start, end, name, hex, value)
+}
@@ -0,0 +1,46 @@
+package binary
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDump(t *testing.T) {
+	out, err := Dump(s0b, s0{})
+	assert.NoError(t, err)
+	assert.Equal(t, ""+
+		"0000-0002  A  01 41  \"A\"\n"+
+		"0002-0004  B  01 42  \"B\"\n"+
+		"0004-0006  C  01 00  1\n", out)
+
+	type Inner struct {
+		N uint32 `binary:"varint"`
+	}
+	type Outer struct {
+		Inner Inner
+		Data  []byte
+		Ptr   *Inner
+	}
+	data, err := Marshal(Outer{Inner{300}, make([]byte, 20), nil})
+	assert.NoError(t, err)
+	out, err = Dump(append(data, 9), &Outer{})
+	assert.NoError(t, err)
+	assert.Equal(t, ""+
+		"0000-0002  Inner.N     ac 02                                                300\n"+
+		"0002-0017  Data        14 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 ...  [0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0]\n"+
+		"0017-0018  Ptr         00                                                   <nil>\n"+
+		"0018-0019  (trailing)  09                                                   \n", out)
+
+	out, err = Dump([]byte{1, 0, 0, 0}, uint32(0))
+	assert.NoError(t, err)
+	assert.Equal(t, "0000-0004  uint32  01 00 00 00  1\n", out)
+
+	out, err = Dump(s0b[:3], s0{})
+	assert.Equal(t, "0000-0002  A  01 41  \"A\"\n", out)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	_, err = Dump([]byte{1, 2}, make(chan int))
+	assert.EqualError(t, err, "binary: unsupported type chan int")
+}
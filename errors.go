@@ -0,0 +1,88 @@
+package binary
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// FieldError records the location within a value at which encoding or
+// decoding failed.
+type FieldError struct {
+	// Path to the failing value, such as "Foo.Bar[3]".
+	Path string
+	Err  error
+}
+
+func (e *FieldError) Error() string {
+	return "binary: field " + e.Path + ": " + strings.TrimPrefix(e.Err.Error(), "binary: ")
+}
+
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// recoverPanic converts a panic in progress into an error stored in *err. It
+// must be deferred directly.
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("binary: recovered panic: %v", r)
+	}
+}
+
+// withPath prepends elem to the path of err. End of input errors are returned
+// unchanged so that callers can continue to compare against them directly.
+func withPath(err error, elem string) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return err
+	}
+	if fe, ok := err.(*FieldError); ok {
+		if !strings.HasPrefix(fe.Path, "[") {
+			elem += "."
+		}
+		fe.Path = elem + fe.Path
+		return fe
+	}
+	return &FieldError{Path: elem, Err: err}
+}
+
+func withField(err error, name string) error {
+	return withPath(err, name)
+}
+
+func withIndex(err error, i int) error {
+	return withPath(err, fmt.Sprintf("[%d]", i))
+}
+
+func withKey(err error, key reflect.Value) error {
+	return withPath(err, fmt.Sprintf("[%v]", key.Interface()))
+}
+
+// mapEntryError notes how far through a map decoding got before failing.
+type mapEntryError struct {
+	err  error
+	i, l int
+}
+
+func (e *mapEntryError) Error() string {
+	return fmt.Sprintf("%s (after %d of %d map entries)", e.err, e.i, e.l)
+}
+
+func (e *mapEntryError) Unwrap() error { return e.err }
+
+// withMapEntry records that err occurred after decoding i of the l entries of
+// a map, unless it is an end of input error or already records this for a
+// nested map. End of input is left bare because Decode promises to return
+// io.EOF and io.ErrUnexpectedEOF themselves, which callers compare with ==.
+func withMapEntry(err error, i, l int) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return err
+	}
+	fe, ok := err.(*FieldError)
+	if !ok {
+		return err
+	}
+	if _, ok := fe.Err.(*mapEntryError); !ok {
+		fe.Err = &mapEntryError{err: fe.Err, i: i, l: l}
+	}
+	return fe
+}
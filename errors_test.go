@@ -0,0 +1,85 @@
+package binary
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errFailingMarshaler = errors.New("marshal failed")
+
+type failingMarshaler struct{}
+
+func (failingMarshaler) MarshalBinary() ([]byte, error) { return nil, errFailingMarshaler }
+
+func TestFieldErrorPath(t *testing.T) {
+	type Inner struct {
+		Ch chan int
+	}
+	type Bar struct {
+		Inners []Inner
+	}
+	type Foo struct {
+		Bar Bar
+	}
+	type S struct {
+		Foo Foo
+	}
+	s := S{Foo: Foo{Bar: Bar{Inners: make([]Inner, 4)}}}
+	_, err := Marshal(s)
+	assert.EqualError(t, err, "binary: field Foo.Bar.Inners[0].Ch: unsupported type chan int")
+	var fe *FieldError
+	assert.True(t, errors.As(err, &fe))
+	assert.Equal(t, "Foo.Bar.Inners[0].Ch", fe.Path)
+
+	type M struct {
+		Values map[string]failingMarshaler
+	}
+	_, err = Marshal(M{Values: map[string]failingMarshaler{"key": {}}})
+	assert.EqualError(t, err, "binary: field Values[key]: marshal failed")
+	assert.True(t, errors.Is(err, errFailingMarshaler))
+}
+
+func TestFieldErrorDecodePath(t *testing.T) {
+	type Inner struct {
+		A int8 `binary:"varint"`
+	}
+	type S struct {
+		Items []Inner
+	}
+	data := []byte{0x2, 0x2, 0xd0, 0xf}
+	err := Unmarshal(data, &S{})
+	assert.EqualError(t, err, "binary: field Items[1].A: varint 1000 overflows int8")
+
+	// Truncation errors are never wrapped.
+	assert.Equal(t, io.ErrUnexpectedEOF, Unmarshal(data[:3], &S{}))
+}
+
+type panickingUnmarshaler [4]byte
+
+func (p *panickingUnmarshaler) UnmarshalBinary(data []byte) error {
+	// Deliberately trusts its input.
+	copy(p[:], data[:4])
+	return nil
+}
+
+func TestRecoverPanic(t *testing.T) {
+	var p panickingUnmarshaler
+	err := Unmarshal([]byte{0x2, 0x1, 0x2}, &p)
+	assert.ErrorContains(t, err, "binary: recovered panic: ")
+	assert.ErrorContains(t, err, "out of range")
+
+	dec := NewDecoder(bytes.NewReader([]byte{0x2, 0x1, 0x2}))
+	assert.Error(t, dec.Decode(&p))
+	assert.Equal(t, 0, dec.depth)
+
+	// Encoding a value read from an unexported field panics in reflect.
+	v := reflect.ValueOf(struct{ t time.Time }{}).Field(0)
+	err = NewEncoder(new(bytes.Buffer)).EncodeValue(v)
+	assert.ErrorContains(t, err, "binary: recovered panic: reflect")
+}
@@ -0,0 +1,199 @@
+package binary
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+var (
+	stringType       = reflect.TypeOf("")
+	uint8Type        = reflect.TypeOf(uint8(0))
+	int8Type         = reflect.TypeOf(int8(0))
+	intType          = reflect.TypeOf(int(0))
+	int32Type        = reflect.TypeOf(int32(0))
+	int64Type        = reflect.TypeOf(int64(0))
+	uint64Type       = reflect.TypeOf(uint64(0))
+	float64Type      = reflect.TypeOf(float64(0))
+	stringSliceType  = reflect.TypeOf([]string(nil))
+	intSliceType     = reflect.TypeOf([]int(nil))
+	int32SliceType   = reflect.TypeOf([]int32(nil))
+	int64SliceType   = reflect.TypeOf([]int64(nil))
+	uint64SliceType  = reflect.TypeOf([]uint64(nil))
+	float64SliceType = reflect.TypeOf([]float64(nil))
+)
+
+// chunkSize is the size of the scratch buffer used to read and write runs of
+// fixed-size slice elements.
+const chunkSize = 4096
+
+// encodeFastSlice writes the elements of the slice rv without reflecting on
+// each one, if its element type is string, int, int32, int64, uint64 or
+// float64 and no codec is registered for it. It reports whether rv was
+// handled. As rune is an alias of int32, this includes []rune, which is
+// written as 4-byte code points rather than as UTF-8 so that it holds any
+// int32 values and round-trips exactly.
+func (b *Encoder) encodeFastSlice(rv reflect.Value) (bool, error) {
+	if _, ok := lookupCodec(rv.Type().Elem()); ok {
+		return false, nil
+	}
+	switch rv.Type().Elem() {
+	case stringType:
+		for _, s := range rv.Convert(stringSliceType).Interface().([]string) {
+			if err := b.writeLen(len(s)); err != nil {
+				return true, err
+			}
+			if _, err := io.WriteString(b.w, s); err != nil {
+				return true, err
+			}
+		}
+		return true, nil
+
+	case intType:
+		s := rv.Convert(intSliceType).Interface().([]int)
+		n, err := intSize(b.IntSize)
+		if err != nil {
+			return true, err
+		}
+		if n == 8 {
+			return true, b.writeWords(len(s), 8, func(buf []byte, i int) { b.Order.PutUint64(buf, uint64(s[i])) })
+		}
+		for i, x := range s {
+			if x != int(int32(x)) {
+				return true, withIndex(fmt.Errorf("binary: int %d overflows IntSize %d", x, n), i)
+			}
+		}
+		return true, b.writeWords(len(s), 4, func(buf []byte, i int) { b.Order.PutUint32(buf, uint32(s[i])) })
+
+	case int32Type:
+		s := rv.Convert(int32SliceType).Interface().([]int32)
+		return true, b.writeWords(len(s), 4, func(buf []byte, i int) { b.Order.PutUint32(buf, uint32(s[i])) })
+
+	case int64Type:
+		s := rv.Convert(int64SliceType).Interface().([]int64)
+		return true, b.writeWords(len(s), 8, func(buf []byte, i int) { b.Order.PutUint64(buf, uint64(s[i])) })
+
+	case uint64Type:
+		s := rv.Convert(uint64SliceType).Interface().([]uint64)
+		return true, b.writeWords(len(s), 8, func(buf []byte, i int) { b.Order.PutUint64(buf, s[i]) })
+
+	case float64Type:
+		s := rv.Convert(float64SliceType).Interface().([]float64)
+		return true, b.writeWords(len(s), 8, func(buf []byte, i int) { b.Order.PutUint64(buf, b.float64bits(s[i])) })
+	}
+	return false, nil
+}
+
+// writeWords writes n elements of the given size, calling put to fill in
+// each one, in chunks of up to chunkSize bytes.
+func (b *Encoder) writeWords(n, size int, put func(buf []byte, i int)) error {
+	if b.chunk == nil {
+		b.chunk = make([]byte, chunkSize)
+	}
+	for i := 0; i < n; {
+		k := 0
+		for ; i < n && k+size <= len(b.chunk); i, k = i+1, k+size {
+			put(b.chunk[k:], i)
+		}
+		if _, err := b.w.Write(b.chunk[:k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeFastSlice reads the elements of the slice rv, which must already
+// have its final length, without reflecting on each one, if its element type
+// is string, int, int32, int64, uint64 or float64 and no codec is registered
+// for it. It reports whether rv was handled. Errors give the index of the
+// failing element offset by base, for when rv is part of a larger slice.
+func (d *Decoder) decodeFastSlice(rv reflect.Value, base int) (bool, error) {
+	if _, ok := lookupCodec(rv.Type().Elem()); ok {
+		return false, nil
+	}
+	switch rv.Type().Elem() {
+	case stringType:
+		s := rv.Convert(stringSliceType).Interface().([]string)
+		for i := range s {
+			var err error
+			if s[i], err = d.readString(); err != nil {
+				return true, withIndex(err, base+i)
+			}
+		}
+		return true, nil
+
+	case intType:
+		s := rv.Convert(intSliceType).Interface().([]int)
+		n, err := intSize(d.IntSize)
+		if err != nil {
+			return true, err
+		}
+		if n == 4 {
+			return true, d.readWords(len(s), 4, func(buf []byte, i int) error {
+				s[i] = int(int32(d.Order.Uint32(buf)))
+				return nil
+			})
+		}
+		return true, d.readWords(len(s), 8, func(buf []byte, i int) error {
+			x := int64(d.Order.Uint64(buf))
+			if int64(int(x)) != x {
+				return withIndex(fmt.Errorf("binary: %d overflows int", x), base+i)
+			}
+			s[i] = int(x)
+			return nil
+		})
+
+	case int32Type:
+		s := rv.Convert(int32SliceType).Interface().([]int32)
+		return true, d.readWords(len(s), 4, func(buf []byte, i int) error {
+			s[i] = int32(d.Order.Uint32(buf))
+			return nil
+		})
+
+	case int64Type:
+		s := rv.Convert(int64SliceType).Interface().([]int64)
+		return true, d.readWords(len(s), 8, func(buf []byte, i int) error {
+			s[i] = int64(d.Order.Uint64(buf))
+			return nil
+		})
+
+	case uint64Type:
+		s := rv.Convert(uint64SliceType).Interface().([]uint64)
+		return true, d.readWords(len(s), 8, func(buf []byte, i int) error {
+			s[i] = d.Order.Uint64(buf)
+			return nil
+		})
+
+	case float64Type:
+		s := rv.Convert(float64SliceType).Interface().([]float64)
+		return true, d.readWords(len(s), 8, func(buf []byte, i int) error {
+			s[i] = math.Float64frombits(d.Order.Uint64(buf))
+			return nil
+		})
+	}
+	return false, nil
+}
+
+// readWords reads n elements of the given size, calling set with each one,
+// in chunks of up to chunkSize bytes.
+func (d *Decoder) readWords(n, size int, set func(buf []byte, i int) error) error {
+	if d.chunk == nil {
+		d.chunk = make([]byte, chunkSize)
+	}
+	for i := 0; i < n; {
+		k := (n - i) * size
+		if k > len(d.chunk) {
+			k = len(d.chunk) / size * size
+		}
+		if _, err := io.ReadFull(d.r, d.chunk[:k]); err != nil {
+			return err
+		}
+		for j := 0; j < k; i, j = i+1, j+size {
+			if err := set(d.chunk[j:j+size], i); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package binary
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFastSlices(t *testing.T) {
+	type IDs []int64
+	type S struct {
+		Strings []string
+		Ints    []int
+		Int64s  IDs
+		Uint64s []uint64
+		Float64 []float64
+		Long    []uint64
+	}
+	s := S{
+		Strings: []string{"a", "", "bc"},
+		Ints:    []int{-1, 0, math.MaxInt},
+		Int64s:  IDs{math.MinInt64, math.MaxInt64},
+		Uint64s: []uint64{math.MaxUint64},
+		Float64: []float64{math.Pi, math.Inf(-1)},
+		Long:    make([]uint64, 1000),
+	}
+	for i := range s.Long {
+		s.Long[i] = uint64(i) * 0x0101010101
+	}
+
+	for _, order := range []binary.ByteOrder{LittleEndian, BigEndian} {
+		buf := new(bytes.Buffer)
+		enc := NewEncoder(buf)
+		enc.Order = order
+		assert.NoError(t, enc.Encode(s))
+
+		expected := new(bytes.Buffer)
+		expected.Write([]byte{0x3, 0x1, 'a', 0x0, 0x2, 'b', 'c', 0x3})
+		assert.NoError(t, binary.Write(expected, order, []int64{-1, 0, math.MaxInt}))
+		expected.WriteByte(0x2)
+		assert.NoError(t, binary.Write(expected, order, s.Int64s))
+		expected.WriteByte(0x1)
+		assert.NoError(t, binary.Write(expected, order, s.Uint64s))
+		expected.WriteByte(0x2)
+		assert.NoError(t, binary.Write(expected, order, s.Float64))
+		expected.Write([]byte{0xe8, 0x7})
+		assert.NoError(t, binary.Write(expected, order, s.Long))
+		assert.Equal(t, expected.Bytes(), buf.Bytes())
+
+		var res S
+		dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+		dec.Order = order
+		assert.NoError(t, dec.Decode(&res))
+		assert.Equal(t, s, res)
+
+		dec = NewDecoder(bytes.NewReader(buf.Bytes()))
+		dec.Order = order
+		assert.NoError(t, dec.Skip(&res))
+		assert.Equal(t, io.EOF, dec.Decode(&res))
+	}
+}
+
+func TestFastSliceIntSize(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.IntSize = 4
+	assert.NoError(t, enc.Encode([]int{-2, 3}))
+	assert.Equal(t, []byte{0x2, 0xfe, 0xff, 0xff, 0xff, 0x3, 0x0, 0x0, 0x0}, buf.Bytes())
+	var res []int
+	dec := NewDecoder(buf)
+	dec.IntSize = 4
+	assert.NoError(t, dec.Decode(&res))
+	assert.Equal(t, []int{-2, 3}, res)
+
+	if strconv.IntSize == 64 {
+		big := int64(1) << 40
+		assert.EqualError(t, enc.Encode([]int{1, int(big)}), "binary: field [1]: int 1099511627776 overflows IntSize 4")
+	}
+}
+
+func TestFastSliceTruncated(t *testing.T) {
+	data, err := Marshal(make([]float64, 1000))
+	assert.NoError(t, err)
+	var res []float64
+	assert.Equal(t, io.ErrUnexpectedEOF, Unmarshal(data[:len(data)-1], &res))
+	assert.Equal(t, io.ErrUnexpectedEOF, Unmarshal(data[:chunkSize+2], &res))
+
+	data, err = Marshal([]string{"abc", "def"})
+	assert.NoError(t, err)
+	var strs []string
+	assert.Equal(t, io.ErrUnexpectedEOF, Unmarshal(data[:len(data)-1], &strs))
+}
+
+func TestFastSliceRunes(t *testing.T) {
+	type S struct {
+		Text  []rune
+		Other []rune
+		Long  []rune
+		R     rune
+	}
+	s := S{
+		Text:  []rune("héllo, 世界 🌍"),
+		Other: []rune{-1, utf8.MaxRune + 1}, // Not valid code points.
+		Long:  []rune(strings.Repeat("ü", 2000)),
+		R:     '世',
+	}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+
+	expected := new(bytes.Buffer)
+	expected.WriteByte(byte(len(s.Text)))
+	assert.NoError(t, binary.Write(expected, LittleEndian, s.Text))
+	assert.Equal(t, expected.Bytes(), data[:expected.Len()])
+
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+	assert.Equal(t, "héllo, 世界 🌍", string(res.Text))
+}
@@ -0,0 +1,66 @@
+package binary
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+)
+
+// EncodeFramed writes v preceded by its encoded length, in the form given by
+// LengthEncoding, so that a reader can find the end of the value without
+// decoding it.
+func (b *Encoder) EncodeFramed(v interface{}) error {
+	buf := &bytes.Buffer{}
+	enc := *b
+	enc.w = buf
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	if err := b.writeLen(buf.Len()); err != nil {
+		return err
+	}
+	_, err := b.w.Write(buf.Bytes())
+	return err
+}
+
+// DecodeFramed reads a value written by EncodeFramed into v. The whole frame
+// is consumed even if decoding fails, so the next call to DecodeFramed will
+// read the following frame. It is an error for the value to not fill the
+// frame exactly.
+//
+// The frame length is not limited by MaxLen, which applies to the lengths
+// within the value, but a frame longer than MaxBytes is skipped and rejected
+// without being decoded.
+func (d *Decoder) DecodeFramed(v interface{}) error {
+	start := d.r.n
+	l, err := d.readLenPrefix()
+	if err != nil {
+		return d.unexpectedEOF(start, err)
+	}
+	if l > math.MaxInt64 {
+		return fmt.Errorf("binary: frame length %d overflows int64", l)
+	}
+	if d.MaxBytes > 0 && l > uint64(d.MaxBytes) {
+		if _, err := io.CopyN(io.Discard, d.r, int64(l)); err != nil {
+			return d.unexpectedEOF(start, err)
+		}
+		return fmt.Errorf("binary: frame length %d exceeds MaxBytes", l)
+	}
+	// The frame is read as it arrives rather than allocated up front, so a
+	// corrupt length cannot claim more memory than the input provides.
+	frame := &bytes.Buffer{}
+	if _, err := io.CopyN(frame, d.r, int64(l)); err != nil {
+		return d.unexpectedEOF(start, err)
+	}
+	fd := *d
+	fd.r = &byteReader{Reader: frame}
+	fd.depth = 0
+	if err := fd.Decode(v); err != nil {
+		return err
+	}
+	if n := int(l) - int(fd.r.n); n != 0 {
+		return fmt.Errorf("binary: %d unread bytes in frame", n)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package binary
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFramedStream(t *testing.T) {
+	r, w := io.Pipe()
+	go func() {
+		enc := NewEncoder(w)
+		for _, v := range []interface{}{s0v, "not an s0", s1v, s0v} {
+			if err := enc.EncodeFramed(v); err != nil {
+				w.CloseWithError(err)
+				return
+			}
+		}
+		w.Close()
+	}()
+
+	dec := NewDecoder(r)
+	res0 := &s0{}
+	assert.NoError(t, dec.DecodeFramed(res0))
+	assert.Equal(t, s0v, res0)
+
+	// A frame that doesn't match the expected type is skipped over.
+	assert.Error(t, dec.DecodeFramed(&s0{}))
+
+	res1 := &s1{}
+	assert.NoError(t, dec.DecodeFramed(res1))
+	assert.Equal(t, s1v, res1)
+
+	res0 = &s0{}
+	assert.NoError(t, dec.DecodeFramed(res0))
+	assert.Equal(t, s0v, res0)
+
+	assert.Equal(t, io.EOF, dec.DecodeFramed(&s0{}))
+}
+
+func TestFramedTrailingBytes(t *testing.T) {
+	data := []byte{0x3, 0x1, 'a', 0xff}
+	var s string
+	assert.Error(t, NewDecoder(bytes.NewReader(data)).DecodeFramed(&s))
+	assert.Equal(t, io.ErrUnexpectedEOF, NewDecoder(bytes.NewReader(data[:2])).DecodeFramed(&s))
+}
+
+func TestFramedLarge(t *testing.T) {
+	// Frames longer than MaxLen are fine, as MaxLen only limits the lengths
+	// within the value.
+	big := []string{strings.Repeat("x", 600<<10), strings.Repeat("y", 600<<10)}
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	enc.LengthEncoding = Fixed32
+	assert.NoError(t, enc.EncodeFramed(big))
+	assert.NoError(t, enc.EncodeFramed(big))
+	assert.NoError(t, enc.EncodeFramed([]string{"small"}))
+	assert.Equal(t, []byte{0x0c, 0xc0, 0x12, 0}, buf.Bytes()[:4])
+
+	dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+	dec.LengthEncoding = Fixed32
+	var s []string
+	assert.NoError(t, dec.DecodeFramed(&s))
+	assert.Equal(t, big, s)
+
+	// A frame longer than MaxBytes is skipped without being decoded.
+	dec.MaxBytes = 1 << 10
+	assert.EqualError(t, dec.DecodeFramed(&s), "binary: frame length 1228812 exceeds MaxBytes")
+	assert.NoError(t, dec.DecodeFramed(&s))
+	assert.Equal(t, []string{"small"}, s)
+	assert.Equal(t, io.EOF, dec.DecodeFramed(&s))
+
+	// A corrupt length only costs as much memory as the input provides.
+	hostile := binary.AppendUvarint(nil, 1<<40)
+	assert.Equal(t, io.ErrUnexpectedEOF, NewDecoder(bytes.NewReader(append(hostile, 1, 2, 3))).DecodeFramed(&s))
+}
@@ -0,0 +1,41 @@
+package binary
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// WriteHeader writes a header made up of a magic number identifying the data
+// and a format version, for readers to check with ReadHeader before decoding
+// what follows. The magic number is always written big-endian, so that the
+// leading bytes of the data are the same whatever the encoder's Order.
+func (b *Encoder) WriteHeader(magic uint32, version uint8) error {
+	var buf [5]byte
+	binary.BigEndian.PutUint32(buf[:], magic)
+	buf[4] = version
+	_, err := b.w.Write(buf[:])
+	return err
+}
+
+// ReadHeader reads a header written by WriteHeader. It returns io.EOF if
+// there is no input left.
+func (d *Decoder) ReadHeader() (magic uint32, version uint8, err error) {
+	buf, err := d.readFixed(5)
+	if err != nil {
+		return 0, 0, err
+	}
+	return binary.BigEndian.Uint32(buf), buf[4], nil
+}
+
+// ExpectHeader reads a header written by WriteHeader and returns its version,
+// failing with an error if its magic number is not magic.
+func (d *Decoder) ExpectHeader(magic uint32) (version uint8, err error) {
+	got, version, err := d.ReadHeader()
+	if err != nil {
+		return 0, err
+	}
+	if got != magic {
+		return 0, fmt.Errorf("binary: bad magic number %#08x, expected %#08x", got, magic)
+	}
+	return version, nil
+}
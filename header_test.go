@@ -0,0 +1,43 @@
+package binary
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeader(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	assert.NoError(t, enc.WriteHeader(0xcafef00d, 3))
+	assert.NoError(t, enc.Encode(s1v))
+	assert.Equal(t, append([]byte{0xca, 0xfe, 0xf0, 0x0d, 3}, svb...), buf.Bytes())
+
+	dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+	magic, version, err := dec.ReadHeader()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0xcafef00d), magic)
+	assert.Equal(t, uint8(3), version)
+	var v s1
+	assert.NoError(t, dec.Decode(&v))
+	assert.Equal(t, *s1v, v)
+
+	dec = NewDecoder(bytes.NewReader(buf.Bytes()))
+	version, err = dec.ExpectHeader(0xcafef00d)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(3), version)
+
+	_, _, err = NewDecoder(bytes.NewReader(nil)).ReadHeader()
+	assert.Equal(t, io.EOF, err)
+	_, _, err = NewDecoder(bytes.NewReader(buf.Bytes()[:3])).ReadHeader()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestHeaderWrongMagic(t *testing.T) {
+	buf := new(bytes.Buffer)
+	assert.NoError(t, NewEncoder(buf).WriteHeader(0xcafef00d, 1))
+	_, err := NewDecoder(buf).ExpectHeader(0xdeadbeef)
+	assert.EqualError(t, err, "binary: bad magic number 0xcafef00d, expected 0xdeadbeef")
+}
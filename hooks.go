@@ -0,0 +1,51 @@
+package binary
+
+import "reflect"
+
+// PreMarshaler may be implemented by a type, or a pointer to one, to prepare
+// a value for encoding, such as by normalizing it. PreMarshal is called
+// before each value of the type is encoded, including struct fields and the
+// elements of slices and maps, and an error returned by it fails the encode.
+// A value passed to Encode through a pointer, and anything reachable from it
+// through pointers, slices or maps, is modified in place; other values are
+// copied first.
+type PreMarshaler interface {
+	PreMarshal() error
+}
+
+// PostUnmarshaler may be implemented by a type, or a pointer to one, to
+// process a value once it has been decoded, such as by normalizing it.
+// PostUnmarshal is called after each value of the type is decoded, including
+// struct fields and the elements of slices and maps, and before Validate for
+// types that also implement Validator. An error returned by it fails the
+// decode.
+type PostUnmarshaler interface {
+	PostUnmarshal() error
+}
+
+var (
+	preMarshalerType    = reflect.TypeOf((*PreMarshaler)(nil)).Elem()
+	postUnmarshalerType = reflect.TypeOf((*PostUnmarshaler)(nil)).Elem()
+	validatorType       = reflect.TypeOf((*Validator)(nil)).Elem()
+)
+
+// preMarshal calls the PreMarshal method of rv, returning the value to encode
+// in its place, which is a copy of rv if rv is not addressable.
+func preMarshal(rv reflect.Value) (reflect.Value, error) {
+	rv = addressable(rv)
+	return rv, rv.Addr().Interface().(PreMarshaler).PreMarshal()
+}
+
+// afterDecode calls the PostUnmarshal and Validate methods of the decoded
+// value rv, as selected by the type flags in hooks.
+func afterDecode(rv reflect.Value, hooks int) error {
+	if hooks&postUnmarshalHook != 0 {
+		if err := rv.Addr().Interface().(PostUnmarshaler).PostUnmarshal(); err != nil {
+			return err
+		}
+	}
+	if hooks&validateHook != 0 {
+		return rv.Addr().Interface().(Validator).Validate()
+	}
+	return nil
+}
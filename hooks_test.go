@@ -0,0 +1,122 @@
+package binary
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type trimmed string
+
+func (t *trimmed) PreMarshal() error {
+	if *t == "fail" {
+		return errors.New("cannot encode fail")
+	}
+	*t = trimmed(strings.TrimSpace(string(*t)))
+	return nil
+}
+
+type reading struct {
+	Value float64
+	Unit  trimmed
+	calls int
+}
+
+func (r *reading) PostUnmarshal() error {
+	r.calls++
+	if math.IsNaN(r.Value) {
+		return errors.New("NaN reading")
+	}
+	r.Value = math.Round(r.Value*100) / 100
+	return nil
+}
+
+// Validate checks that PostUnmarshal has already run.
+func (r *reading) Validate() error {
+	if r.calls != 1 {
+		return errors.New("PostUnmarshal not called first")
+	}
+	return nil
+}
+
+func TestHooks(t *testing.T) {
+	type S struct {
+		Name     trimmed
+		Reading  reading
+		Readings []reading
+		ByName   map[trimmed]*reading
+	}
+	s := S{
+		Name:     "  bob ",
+		Reading:  reading{Value: 1.23456, Unit: " kg"},
+		Readings: []reading{{Value: 2.005}},
+		ByName:   map[trimmed]*reading{" x ": {Value: 3.14159}},
+	}
+
+	// Values passed by value are not modified.
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, trimmed("  bob "), s.Name)
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, trimmed("bob"), res.Name)
+	assert.Equal(t, reading{Value: 1.23, Unit: "kg", calls: 1}, res.Reading)
+	assert.Equal(t, []reading{{Value: 2.01, calls: 1}}, res.Readings)
+	assert.Equal(t, 3.14, res.ByName["x"].Value)
+
+	// Values passed by pointer are normalized in place.
+	data2, err := Marshal(&s)
+	assert.NoError(t, err)
+	assert.Equal(t, data, data2)
+	assert.Equal(t, trimmed("bob"), s.Name)
+	assert.Equal(t, trimmed("kg"), s.Reading.Unit)
+
+	// Hooks also run on top-level values.
+	name := trimmed(" top ")
+	data, err = Marshal(&name)
+	assert.NoError(t, err)
+	assert.Equal(t, trimmed("top"), name)
+	var r reading
+	data, err = Marshal(reading{Value: 0.125})
+	assert.NoError(t, err)
+	assert.NoError(t, Unmarshal(data, &r))
+	assert.Equal(t, 0.13, r.Value)
+}
+
+func TestHookErrors(t *testing.T) {
+	type S struct {
+		Readings []reading
+	}
+	_, err := Marshal(S{Readings: []reading{{}, {Unit: "fail"}}})
+	assert.EqualError(t, err, "binary: field Readings[1].Unit: cannot encode fail")
+
+	data, err := Marshal(S{Readings: []reading{{Value: math.NaN()}}})
+	assert.NoError(t, err)
+	var res S
+	assert.EqualError(t, Unmarshal(data, &res), "binary: field Readings[0]: NaN reading")
+}
+
+type countedHook struct {
+	N     int
+	calls *int
+}
+
+func (c *countedHook) PreMarshal() error {
+	*c.calls++
+	return nil
+}
+
+func TestPreMarshalCalledOnce(t *testing.T) {
+	calls := 0
+	_, err := Marshal(&countedHook{N: 1, calls: &calls})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	calls = 0
+	_, err = MarshalTo(make([]byte, 16), &countedHook{N: 1, calls: &calls})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
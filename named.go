@@ -0,0 +1,170 @@
+package binary
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// tagName returns the name given by a non-empty name=X option in the
+// `binary` tag of f, the field's own name if the tag has a named option or an
+// empty name=, or the empty string if it has neither.
+func tagName(f reflect.StructField) string {
+	name := ""
+	for _, o := range strings.Split(f.Tag.Get("binary"), ",") {
+		switch {
+		case strings.HasPrefix(o, "name=") && o != "name=":
+			return strings.TrimPrefix(o, "name=")
+		case o == "named" || o == "name=":
+			name = f.Name
+		}
+	}
+	return name
+}
+
+// isNamed reports whether any of fields has a name tag, making the struct
+// they belong to a named struct.
+func isNamed(fields []field) bool {
+	for _, f := range fields {
+		if f.named != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// encodedName returns the name under which the field f of a named struct is
+// written.
+func encodedName(f field) string {
+	if f.named != "" {
+		return f.named
+	}
+	return f.name
+}
+
+// checkNames checks that each field of the named struct type t that is to be
+// encoded has a distinct name.
+func checkNames(t reflect.Type, fields []field, includeUnexported bool) error {
+	names := map[string]string{}
+	for _, f := range fields {
+		if f.unexported && !includeUnexported {
+			continue
+		}
+		name := encodedName(f)
+		if other, ok := names[name]; ok {
+			return fmt.Errorf("binary: fields %s and %s of %s have the same name %q", other, f.name, t, name)
+		}
+		names[name] = f.name
+	}
+	return nil
+}
+
+// encodeNamedFields writes the number of fields of the addressable named
+// struct rv, followed by each field's name and length-prefixed value.
+func (b *Encoder) encodeNamedFields(rv reflect.Value, fields []field) error {
+	if err := checkNames(rv.Type(), fields, b.IncludeUnexported); err != nil {
+		return err
+	}
+	n := 0
+	for _, f := range fields {
+		if b.taggedFieldPresent(rv, f) {
+			n++
+		}
+	}
+	if err := b.writeLen(n); err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	for _, f := range fields {
+		if !b.taggedFieldPresent(rv, f) {
+			continue
+		}
+		name := encodedName(f)
+		if err := b.writeLen(len(name)); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(b.w, name); err != nil {
+			return err
+		}
+		if err := b.encodeDelimited(buf, f, fieldValue(rv, f)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeNamedFields reads a named struct as written by
+// Encoder.encodeNamedFields into the addressable struct rv. Fields that are
+// not present are set to zero, and those with unknown names are skipped.
+func (d *Decoder) decodeNamedFields(rv reflect.Value, fields []field) error {
+	if err := checkNames(rv.Type(), fields, d.IncludeUnexported); err != nil {
+		return err
+	}
+	byName := make(map[string]field, len(fields))
+	for _, f := range fields {
+		if f.unexported && !d.IncludeUnexported {
+			continue
+		}
+		byName[encodedName(f)] = f
+		fieldValue(rv, f).Set(reflect.Zero(rv.Type().Field(f.index).Type))
+	}
+	n, err := d.readLen()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		name, err := d.readString()
+		if err != nil {
+			return err
+		}
+		l, err := d.readLen()
+		if err != nil {
+			return err
+		}
+		refs, err := d.readFieldRefs(l)
+		if err != nil {
+			return err
+		}
+		f, ok := byName[name]
+		if !ok {
+			if err := d.skipDelimited(l, refs); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.decodeDelimited(f, fieldValue(rv, f), l, refs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipNamedFields skips a named struct.
+func (d *Decoder) skipNamedFields() error {
+	n, err := d.readLen()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		l, err := d.readLen()
+		if err != nil {
+			return err
+		}
+		if err := d.discard(l); err != nil {
+			return err
+		}
+		if l, err = d.readLen(); err != nil {
+			return err
+		}
+		refs, err := d.readFieldRefs(l)
+		if err != nil {
+			return err
+		}
+		if err := d.skipDelimited(l, refs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
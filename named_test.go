@@ -0,0 +1,111 @@
+package binary
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type namedV1 struct {
+	ID    int16 `binary:"named"`
+	Name  string
+	Score int `binary:"varint"`
+}
+
+// namedV2 reorders the fields of namedV1, removes Score, adds Email and
+// renames Name to Label while keeping its encoded name.
+type namedV2 struct {
+	Email string `binary:"named"`
+	Label string `binary:"name=Name"`
+	ID    int16
+}
+
+func TestNamedFields(t *testing.T) {
+	v1 := namedV1{ID: 7, Name: "bob", Score: -3}
+	data, err := Marshal(v1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		3,
+		2, 'I', 'D', 2, 7, 0,
+		4, 'N', 'a', 'm', 'e', 4, 3, 'b', 'o', 'b',
+		5, 'S', 'c', 'o', 'r', 'e', 1, 5,
+	}, data)
+
+	var res1 namedV1
+	assert.NoError(t, Unmarshal(data, &res1))
+	assert.Equal(t, v1, res1)
+
+	// Score is skipped, and Email is missing so left zero.
+	res2 := namedV2{Email: "stale"}
+	assert.NoError(t, Unmarshal(data, &res2))
+	assert.Equal(t, namedV2{Label: "bob", ID: 7}, res2)
+
+	// Going the other way, Email is skipped and Score is left zero.
+	data, err = Marshal(namedV2{Email: "e@x", Label: "al", ID: 2})
+	assert.NoError(t, err)
+	res1 = namedV1{Score: 9}
+	assert.NoError(t, Unmarshal(data, &res1))
+	assert.Equal(t, namedV1{ID: 2, Name: "al"}, res1)
+
+	dec := NewDecoder(bytes.NewReader(append(data, data...)))
+	assert.NoError(t, dec.Skip(&namedV1{}))
+	assert.NoError(t, dec.Decode(&res2))
+	assert.Equal(t, namedV2{Email: "e@x", Label: "al", ID: 2}, res2)
+	assert.Equal(t, io.EOF, dec.Decode(&res2))
+}
+
+func TestNamedFieldErrors(t *testing.T) {
+	type Dup struct {
+		A int `binary:"named"`
+		B int `binary:"name=A"`
+	}
+	_, err := Marshal(Dup{})
+	assert.EqualError(t, err, `binary: fields A and B of binary.Dup have the same name "A"`)
+	assert.Error(t, Valid(Dup{}))
+
+	type Mixed struct {
+		A int `binary:"1,named"`
+	}
+	_, err = Marshal(Mixed{})
+	assert.EqualError(t, err, "binary: field A of tagged struct binary.Mixed has a name tag")
+
+	type S struct {
+		A string `binary:"named"`
+	}
+	data, err := Marshal(struct {
+		A int16 `binary:"named"`
+	}{5})
+	assert.NoError(t, err)
+	assert.Equal(t, io.ErrUnexpectedEOF, Unmarshal(data, &S{}))
+}
+
+func TestNamedFieldsTrackRefs(t *testing.T) {
+	type V2 struct {
+		X *node `binary:"named"`
+		Y *node
+		Z *node
+	}
+	// V1 lacks X, so the references first written within it are skipped.
+	type V1 struct {
+		Y *node `binary:"named"`
+		Z *node
+	}
+	shared := &node{Value: 2}
+	v := V2{X: &node{Value: 9, Next: &node{Value: 10}}, Y: shared, Z: shared}
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.TrackRefs = true
+	assert.NoError(t, enc.Encode(v))
+	assert.NoError(t, enc.Encode(v))
+
+	dec := NewDecoder(buf)
+	dec.TrackRefs = true
+	var res V1
+	assert.NoError(t, dec.Decode(&res))
+	assert.Equal(t, int8(2), res.Y.Value)
+	assert.True(t, res.Y == res.Z)
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+}
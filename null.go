@@ -0,0 +1,65 @@
+package binary
+
+import (
+	"database/sql"
+	"reflect"
+)
+
+// nullTypes are the database/sql nullable types. Each is a struct holding a
+// value field followed by a Valid flag, and is encoded as the flag followed
+// by the value only if the flag is set.
+var nullTypes = map[reflect.Type]bool{
+	reflect.TypeOf(sql.NullBool{}):    true,
+	reflect.TypeOf(sql.NullByte{}):    true,
+	reflect.TypeOf(sql.NullFloat64{}): true,
+	reflect.TypeOf(sql.NullInt16{}):   true,
+	reflect.TypeOf(sql.NullInt32{}):   true,
+	reflect.TypeOf(sql.NullInt64{}):   true,
+	reflect.TypeOf(sql.NullString{}):  true,
+	reflect.TypeOf(sql.NullTime{}):    true,
+}
+
+// encodeNull writes the Valid flag of the database/sql nullable rv, followed
+// by its value if it is valid.
+func (b *Encoder) encodeNull(rv reflect.Value) error {
+	if !rv.FieldByName("Valid").Bool() {
+		_, err := b.w.Write([]byte{0})
+		return err
+	}
+	if _, err := b.w.Write([]byte{1}); err != nil {
+		return err
+	}
+	if err := b.encodeValue(rv.Field(0)); err != nil {
+		return withField(err, rv.Type().Field(0).Name)
+	}
+	return nil
+}
+
+// decodeNull reads a database/sql nullable as written by Encoder.encodeNull.
+func (d *Decoder) decodeNull(rv reflect.Value) error {
+	valid, err := d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	rv.Set(reflect.Zero(rv.Type()))
+	if valid == 0 {
+		return nil
+	}
+	rv.FieldByName("Valid").SetBool(true)
+	if err := d.decodeValue(rv.Field(0)); err != nil {
+		return withField(err, rv.Type().Field(0).Name)
+	}
+	return nil
+}
+
+// skipNull skips a database/sql nullable of type t.
+func (d *Decoder) skipNull(t reflect.Type) error {
+	valid, err := d.r.ReadByte()
+	if err != nil || valid == 0 {
+		return err
+	}
+	if err := d.skipValue(t.Field(0).Type); err != nil {
+		return withField(err, t.Field(0).Name)
+	}
+	return nil
+}
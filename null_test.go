@@ -0,0 +1,63 @@
+package binary
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNullString(t *testing.T) {
+	valid := sql.NullString{String: "hello", Valid: true}
+	data, err := Marshal(valid)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x1, 0x5, 'h', 'e', 'l', 'l', 'o'}, data)
+	var res sql.NullString
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, valid, res)
+
+	// The value of an invalid NullString is not written, and is cleared on
+	// decode.
+	invalid := sql.NullString{String: "garbage"}
+	data, err = Marshal(invalid)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x0}, data)
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, sql.NullString{}, res)
+}
+
+func TestNullTypesInStruct(t *testing.T) {
+	type Row struct {
+		ID      sql.NullInt64
+		Name    sql.NullString
+		Score   sql.NullFloat64
+		Active  sql.NullBool
+		Created sql.NullTime
+		Rank    sql.NullInt32
+	}
+	row := Row{
+		ID:      sql.NullInt64{Int64: 42, Valid: true},
+		Name:    sql.NullString{String: "x", Valid: true},
+		Score:   sql.NullFloat64{Float64: 1.5},
+		Created: sql.NullTime{Time: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), Valid: true},
+	}
+	data, err := Marshal(row)
+	assert.NoError(t, err)
+	var res Row
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, sql.NullFloat64{}, res.Score)
+	assert.True(t, row.Created.Time.Equal(res.Created.Time))
+	res.Created.Time = row.Created.Time
+	row.Score = sql.NullFloat64{}
+	assert.Equal(t, row, res)
+
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+
+	err = Unmarshal([]byte{0x1, 0x5}, &res.Name)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
@@ -0,0 +1,58 @@
+package binary
+
+import (
+	"io"
+	"reflect"
+)
+
+// optionalFields returns the number of optional fields among fields that are
+// to be encoded.
+func optionalFields(fields []field, includeUnexported bool) int {
+	n := 0
+	for _, f := range fields {
+		if f.optional && (!f.unexported || includeUnexported) {
+			n++
+		}
+	}
+	return n
+}
+
+// isPresent reports whether bit i of the presence bitmap is set.
+func isPresent(present []byte, i int) bool {
+	return present[i/8]&(1<<(i%8)) != 0
+}
+
+// writePresence writes the presence bitmap of the optional fields of the
+// addressable struct rv, and returns it. It writes nothing and returns nil if
+// there are no optional fields.
+func (b *Encoder) writePresence(rv reflect.Value, fields []field) ([]byte, error) {
+	n := optionalFields(fields, b.IncludeUnexported)
+	if n == 0 {
+		return nil, nil
+	}
+	present := make([]byte, (n+7)/8)
+	k := 0
+	for _, f := range fields {
+		if !f.optional || f.unexported && !b.IncludeUnexported {
+			continue
+		}
+		if !fieldValue(rv, f).IsZero() {
+			present[k/8] |= 1 << (k % 8)
+		}
+		k++
+	}
+	_, err := b.w.Write(present)
+	return present, err
+}
+
+// readPresence reads the presence bitmap written by Encoder.writePresence for
+// a struct with the given fields.
+func (d *Decoder) readPresence(fields []field) ([]byte, error) {
+	n := optionalFields(fields, d.IncludeUnexported)
+	if n == 0 {
+		return nil, nil
+	}
+	present := make([]byte, (n+7)/8)
+	_, err := io.ReadFull(d.r, present)
+	return present, err
+}
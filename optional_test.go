@@ -0,0 +1,72 @@
+package binary
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sparse struct {
+	ID     uint16 `binary:"optional"`
+	Name   string `binary:"optional"`
+	Always uint8
+	Score  float64           `binary:"optional"`
+	Tags   []string          `binary:"optional"`
+	Attrs  map[string]string `binary:"optional"`
+	Next   *sparse           `binary:"optional"`
+	Count  int               `binary:"optional,varint"`
+	Flag   bool              `binary:"optional"`
+	Note   string
+}
+
+func TestOptionalFields(t *testing.T) {
+	s := sparse{Name: "bob", Always: 7, Count: -2}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x42, // Name and Count present, of eight optional fields.
+		3, 'b', 'o', 'b',
+		7,
+		3,
+		0,
+	}, data)
+
+	res := sparse{ID: 1, Score: 2, Tags: []string{"stale"}, Flag: true}
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+
+	full := sparse{
+		ID: 1, Name: "a", Always: 2, Score: 3, Tags: []string{"t"}, Attrs: map[string]string{"k": "v"},
+		Next: &sparse{Flag: true, Tags: []string{}}, Count: 4, Flag: true, Note: "n",
+	}
+	data, err = Marshal(full)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0xff), data[0])
+	res = sparse{}
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, full, res)
+
+	dec := NewDecoder(bytes.NewReader(append(data, data...)))
+	assert.NoError(t, dec.Skip(&res))
+	res = sparse{}
+	assert.NoError(t, dec.Decode(&res))
+	assert.Equal(t, full, res)
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+	assert.Equal(t, io.ErrUnexpectedEOF, Unmarshal(data[:1], &res))
+}
+
+func TestOptionalTaggedFields(t *testing.T) {
+	type S struct {
+		A int    `binary:"1,optional"`
+		B string `binary:"2,optional"`
+		C bool   `binary:"3"`
+	}
+	data, err := Marshal(S{B: "x"})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2, 2, 2, 1, 'x', 3, 1, 0}, data)
+	res := S{A: 5}
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, S{B: "x"}, res)
+}
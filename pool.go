@@ -0,0 +1,49 @@
+package binary
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledBuffer is the capacity above which a buffer is dropped rather than
+// returned to the pool, so that one large value does not pin memory.
+const maxPooledBuffer = 64 << 10
+
+// pooledEncoder is an encoder together with the buffer it writes to.
+type pooledEncoder struct {
+	buf bytes.Buffer
+	enc *Encoder
+}
+
+var encoderPool = sync.Pool{
+	New: func() interface{} {
+		p := &pooledEncoder{}
+		p.enc = NewEncoder(&p.buf)
+		return p
+	},
+}
+
+// MarshalPooled is like Marshal but encodes into a buffer taken from a pool,
+// avoiding an allocation per call once the pool is warm. The returned bytes
+// remain valid only until release is called, after which the buffer may be
+// reused by another call, so they must be copied or fully consumed first.
+// Calls to release after the first do nothing. If an error is returned,
+// release is nil and there is nothing to release.
+func MarshalPooled(v interface{}) (data []byte, release func(), err error) {
+	p := encoderPool.Get().(*pooledEncoder)
+	p.buf.Reset()
+	p.enc.Order = DefaultEndian
+	if err := p.enc.Encode(v); err != nil {
+		putPooledEncoder(p)
+		return nil, nil, err
+	}
+	var once sync.Once
+	return p.buf.Bytes(), func() { once.Do(func() { putPooledEncoder(p) }) }, nil
+}
+
+func putPooledEncoder(p *pooledEncoder) {
+	if p.buf.Cap() > maxPooledBuffer {
+		return
+	}
+	encoderPool.Put(p)
+}
@@ -0,0 +1,65 @@
+package binary
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalPooled(t *testing.T) {
+	want, err := Marshal(s1v)
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		data, release, err := MarshalPooled(s1v)
+		assert.NoError(t, err)
+		assert.Equal(t, want, data)
+		release()
+	}
+
+	data, release, err := MarshalPooled(complex(1, 2))
+	assert.NoError(t, err)
+	var c complex128
+	assert.NoError(t, Unmarshal(data, &c))
+	assert.Equal(t, complex(1, 2), c)
+	release()
+
+	data, release, err = MarshalPooled(make(chan int))
+	assert.Error(t, err)
+	assert.Nil(t, data)
+	assert.Nil(t, release)
+
+	// Releasing twice does not hand the same buffer to two callers.
+	_, release, err = MarshalPooled(s0v)
+	assert.NoError(t, err)
+	release()
+	release()
+	data, release, err = MarshalPooled(s1v)
+	assert.NoError(t, err)
+	other, releaseOther, err := MarshalPooled(s0v)
+	assert.NoError(t, err)
+	assert.Equal(t, want, data)
+	assert.NotEqual(t, want, other)
+	release()
+	releaseOther()
+
+	// An oversized buffer is not retained.
+	data, release, err = MarshalPooled(make([]byte, maxPooledBuffer+1))
+	assert.NoError(t, err)
+	assert.Equal(t, maxPooledBuffer+4, len(data))
+	release()
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = Marshal(s1v)
+	}
+}
+
+func BenchmarkMarshalPooled(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, release, _ := MarshalPooled(s1v)
+		release()
+	}
+}
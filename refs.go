@@ -0,0 +1,92 @@
+package binary
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+)
+
+// ref identifies a pointer by its type and address.
+type ref struct {
+	t reflect.Type
+	p uintptr
+}
+
+// trackRoot records the top-level value rv as reference zero. If rv is not a
+// pointer nothing can refer back to it, so a placeholder is recorded instead.
+func (b *Encoder) trackRoot(rv reflect.Value) {
+	if rv.Kind() == reflect.Ptr {
+		b.refs[ref{rv.Type(), rv.Pointer()}] = 0
+	} else {
+		b.refs[ref{}] = 0
+	}
+}
+
+// encodeRef writes the pointer rv when TrackRefs is set. A nil pointer is
+// written as zero, the first occurrence of a pointer as one followed by the
+// pointed-to value, and later occurrences as two plus its reference number.
+// Reference numbers are assigned in order of first occurrence.
+func (b *Encoder) encodeRef(rv reflect.Value) error {
+	if rv.IsNil() {
+		return b.writeVarint(0)
+	}
+	key := ref{rv.Type(), rv.Pointer()}
+	if id, ok := b.refs[key]; ok {
+		return b.writeVarint(id + 2)
+	}
+	b.refs[key] = len(b.refs)
+	if err := b.writeVarint(1); err != nil {
+		return err
+	}
+	if rv.Elem().Kind() == reflect.Ptr {
+		return b.encodePtr(rv.Elem())
+	}
+	return b.encodeValue(rv.Elem())
+}
+
+// decodeRef reads a pointer written by Encoder.encodeRef into rv. The first
+// occurrence of a pointer is always decoded into a newly allocated value.
+func (d *Decoder) decodeRef(rv reflect.Value) error {
+	n, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return err
+	}
+	switch n {
+	case 0:
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	case 1:
+		rv.Set(reflect.New(rv.Type().Elem()))
+		d.refs = append(d.refs, rv.Elem().Addr())
+		if rv.Elem().Kind() == reflect.Ptr {
+			return d.decodePtr(rv.Elem())
+		}
+		return d.decodeValue(rv.Elem())
+	}
+	id := n - 2
+	if id >= uint64(len(d.refs)) {
+		return fmt.Errorf("binary: invalid reference %d", id)
+	}
+	p := d.refs[id]
+	if !p.IsValid() {
+		return fmt.Errorf("binary: reference %d is to a skipped value", id)
+	}
+	if p.Type() != rv.Type() {
+		return fmt.Errorf("binary: reference %d is to %s, not %s", id, p.Type(), rv.Type())
+	}
+	rv.Set(p)
+	return nil
+}
+
+// skipRef skips a pointer of type t written by Encoder.encodeRef.
+func (d *Decoder) skipRef(t reflect.Type) error {
+	n, err := binary.ReadUvarint(d.r)
+	if err != nil || n != 1 {
+		return err
+	}
+	d.refs = append(d.refs, reflect.Value{})
+	if t.Elem().Kind() == reflect.Ptr {
+		return d.skipPtr(t.Elem())
+	}
+	return d.skipValue(t.Elem())
+}
@@ -0,0 +1,83 @@
+package binary
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type node struct {
+	Value      int8
+	Prev, Next *node
+}
+
+func TestTrackRefsCycle(t *testing.T) {
+	a := &node{Value: 1}
+	b := &node{Value: 2, Prev: a, Next: a}
+	a.Prev, a.Next = b, b
+
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.TrackRefs = true
+	assert.NoError(t, enc.Encode(a))
+	assert.Equal(t, []byte{0x1, 0x1, 0x2, 0x2, 0x2, 0x3}, buf.Bytes())
+
+	res := &node{}
+	dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+	dec.TrackRefs = true
+	assert.NoError(t, dec.Decode(res))
+	assert.Equal(t, int8(1), res.Value)
+	assert.Equal(t, int8(2), res.Next.Value)
+	assert.True(t, res.Prev == res.Next)
+	assert.True(t, res.Next.Prev == res)
+	assert.True(t, res.Next.Next == res)
+
+	dec = NewDecoder(bytes.NewReader(buf.Bytes()))
+	dec.TrackRefs = true
+	assert.NoError(t, dec.Skip(res))
+	assert.Equal(t, io.EOF, dec.Decode(res))
+}
+
+func TestTrackRefsShared(t *testing.T) {
+	type Pair struct {
+		A, B *s0
+		C    **s0
+	}
+	shared := &s0{A: "shared", B: "value"}
+	p := Pair{A: shared, B: shared, C: &shared}
+
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.TrackRefs = true
+	assert.NoError(t, enc.Encode(p))
+	untracked, err := Marshal(p)
+	assert.NoError(t, err)
+	assert.Less(t, buf.Len(), len(untracked))
+
+	var res Pair
+	dec := NewDecoder(buf)
+	dec.TrackRefs = true
+	assert.NoError(t, dec.Decode(&res))
+	assert.Equal(t, shared, res.A)
+	assert.True(t, res.A == res.B)
+	assert.True(t, *res.C == res.A)
+
+	// References do not carry over between values.
+	buf.Reset()
+	assert.NoError(t, enc.Encode(p))
+	assert.NoError(t, enc.Encode(p))
+	var res1, res2 Pair
+	assert.NoError(t, dec.Decode(&res1))
+	assert.NoError(t, dec.Decode(&res2))
+	assert.Equal(t, res1, res2)
+	assert.False(t, res1.A == res2.A)
+}
+
+func TestTrackRefsInvalid(t *testing.T) {
+	dec := NewDecoder(bytes.NewReader([]byte{0x1, 0x5}))
+	dec.TrackRefs = true
+	err := dec.Decode(&node{})
+	assert.EqualError(t, err, "binary: field Prev: invalid reference 3")
+}
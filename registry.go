@@ -0,0 +1,176 @@
+package binary
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+var (
+	registryLock sync.RWMutex
+	typesByName  = map[string]reflect.Type{}
+	namesByType  = map[reflect.Type]string{}
+	// builtinNames holds the names registered by the package itself, which
+	// later registrations replace rather than conflict with.
+	builtinNames = map[string]bool{}
+)
+
+// The builtin scalar types and []byte are registered up front, as with gob,
+// so that they can be held in interface values without further setup.
+func init() {
+	for _, v := range []interface{}{
+		false, "", []byte(nil),
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0), uintptr(0),
+		float32(0), float64(0), complex64(0), complex128(0),
+	} {
+		rt := reflect.TypeOf(v)
+		typesByName[rt.String()] = rt
+		namesByType[rt] = rt.String()
+		builtinNames[rt.String()] = true
+	}
+}
+
+// Register records the concrete type of v so that values of that type can be
+// encoded and decoded through interface values. The type is identified on the
+// wire by a name derived from its package path and type name. Only values
+// held in interfaces are written with their type name, so a top-level value
+// must be encoded and decoded through a pointer to an interface variable. A
+// nil interface value is written as the empty name, which is reserved for it
+// and decodes as nil. The builtin scalar types and []byte are registered
+// already.
+//
+// Register panics if the derived name is already in use by another type.
+func Register(v interface{}) {
+	rt := reflect.TypeOf(v)
+	name := rt.String()
+	star := ""
+	if rt.Name() == "" && rt.Kind() == reflect.Ptr {
+		star = "*"
+		rt = rt.Elem()
+	}
+	if rt.Name() != "" && rt.PkgPath() != "" {
+		name = star + rt.PkgPath() + "." + rt.Name()
+	}
+	RegisterName(name, v)
+}
+
+// RegisterName is like Register but uses the provided name rather than one
+// derived from the type.
+//
+// RegisterName panics if the name or the type is already registered under a
+// different type or name, except that it may replace the registration of a
+// builtin type. A builtin type given a new name is still decoded under its
+// builtin name too.
+func RegisterName(name string, v interface{}) {
+	if name == "" {
+		panic("binary: attempt to register empty name")
+	}
+	rt := reflect.TypeOf(v)
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if t, ok := typesByName[name]; ok && t != rt {
+		if !builtinNames[name] {
+			panic(fmt.Sprintf("binary: registering duplicate types for %q: %s != %s", name, t, rt))
+		}
+		if namesByType[t] == name {
+			delete(namesByType, t)
+		}
+		delete(builtinNames, name)
+	}
+	if n, ok := namesByType[rt]; ok && n != name && !builtinNames[n] {
+		panic(fmt.Sprintf("binary: registering duplicate names for %s: %q != %q", rt, n, name))
+	}
+	typesByName[name] = rt
+	namesByType[rt] = name
+}
+
+func registeredName(rt reflect.Type) (string, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	name, ok := namesByType[rt]
+	return name, ok
+}
+
+func registeredType(name string) (reflect.Type, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	rt, ok := typesByName[name]
+	return rt, ok
+}
+
+// encodeInterface writes the registered name of the concrete type held by the
+// interface rv, followed by the concrete value itself, or just the empty name
+// if rv is nil.
+func (b *Encoder) encodeInterface(rv reflect.Value) error {
+	if rv.IsNil() {
+		return b.writeLen(0)
+	}
+	elem := rv.Elem()
+	name, ok := registeredName(elem.Type())
+	if !ok {
+		return errors.New("binary: type not registered for interface: " + elem.Type().String())
+	}
+	// The name is written directly, as read by readString, so that a codec
+	// registered for string cannot change it.
+	if err := b.writeLen(len(name)); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(b.w, name); err != nil {
+		return err
+	}
+	if elem.Kind() == reflect.Ptr {
+		return b.encodePtr(elem)
+	}
+	return b.encodeValue(elem)
+}
+
+// decodeInterface reads a registered type name and a value of that type,
+// storing the result in the interface rv, or sets rv to nil if the name is
+// empty.
+func (d *Decoder) decodeInterface(rv reflect.Value) error {
+	name, err := d.readString()
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+	rt, ok := registeredType(name)
+	if !ok {
+		return fmt.Errorf("binary: name not registered for interface: %q", name)
+	}
+	if !rt.AssignableTo(rv.Type()) {
+		return fmt.Errorf("binary: %s is not assignable to type %s", rt, rv.Type())
+	}
+	elem := reflect.New(rt).Elem()
+	if rt.Kind() == reflect.Ptr {
+		err = d.decodePtr(elem)
+	} else {
+		err = d.decodeValue(elem)
+	}
+	if err != nil {
+		return err
+	}
+	rv.Set(elem)
+	return nil
+}
+
+// skipInterface skips a registered type name and a value of that type.
+func (d *Decoder) skipInterface() error {
+	name, err := d.readString()
+	if err != nil || name == "" {
+		return err
+	}
+	rt, ok := registeredType(name)
+	if !ok {
+		return fmt.Errorf("binary: name not registered for interface: %q", name)
+	}
+	if rt.Kind() == reflect.Ptr {
+		return d.skipPtr(rt)
+	}
+	return d.skipValue(rt)
+}
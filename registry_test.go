@@ -0,0 +1,236 @@
+package binary
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Event interface {
+	Kind() string
+}
+
+type Click struct {
+	X, Y int16
+}
+
+func (Click) Kind() string { return "click" }
+
+type KeyPress struct {
+	Key string
+}
+
+func (*KeyPress) Kind() string { return "keypress" }
+
+func init() {
+	Register(Click{})
+	Register(&KeyPress{})
+}
+
+func TestRegisterNames(t *testing.T) {
+	name, ok := registeredName(reflect.TypeOf(Click{}))
+	assert.True(t, ok)
+	assert.Equal(t, "github.com/alecthomas/binary.Click", name)
+	name, ok = registeredName(reflect.TypeOf(&KeyPress{}))
+	assert.True(t, ok)
+	assert.Equal(t, "*github.com/alecthomas/binary.KeyPress", name)
+
+	assert.Panics(t, func() { RegisterName("github.com/alecthomas/binary.Click", KeyPress{}) })
+	assert.Panics(t, func() { RegisterName("other", Click{}) })
+}
+
+func TestRegisterOverridesBuiltins(t *testing.T) {
+	type myUint16 uint16
+	complexType := reflect.TypeOf(complex64(0))
+	uint16Type := reflect.TypeOf(uint16(0))
+	t.Cleanup(func() {
+		registryLock.Lock()
+		defer registryLock.Unlock()
+		delete(typesByName, "myComplex")
+		delete(namesByType, reflect.TypeOf(myUint16(0)))
+		typesByName["complex64"] = complexType
+		namesByType[complexType] = "complex64"
+		typesByName["uint16"] = uint16Type
+		namesByType[uint16Type] = "uint16"
+		builtinNames["complex64"] = true
+		builtinNames["uint16"] = true
+	})
+
+	assert.NotPanics(t, func() { RegisterName("myComplex", complex64(0)) })
+	assert.NotPanics(t, func() { RegisterName("uint16", myUint16(0)) })
+	assert.Panics(t, func() { RegisterName("other", complex64(0)) })
+
+	name, ok := registeredName(complexType)
+	assert.True(t, ok)
+	assert.Equal(t, "myComplex", name)
+	_, ok = registeredName(uint16Type)
+	assert.False(t, ok)
+
+	values := []interface{}{complex64(1 + 2i), myUint16(3)}
+	data, err := Marshal(values)
+	assert.NoError(t, err)
+	var res []interface{}
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, values, res)
+
+	// Data written under the builtin name still decodes.
+	rt, ok := registeredType("complex64")
+	assert.True(t, ok)
+	assert.Equal(t, complexType, rt)
+}
+
+func TestInterfaceSlice(t *testing.T) {
+	events := []Event{Click{1, 2}, &KeyPress{"a"}, Click{3, 4}}
+	data, err := Marshal(events)
+	assert.NoError(t, err)
+	var res []Event
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, events, res)
+}
+
+func TestInterfaceStructField(t *testing.T) {
+	type S struct {
+		Name  string
+		Event Event
+	}
+	s := S{Name: "test", Event: &KeyPress{"enter"}}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+}
+
+func TestInterfaceUnregistered(t *testing.T) {
+	type unregistered struct{ Event }
+	_, err := Marshal([]Event{unregistered{}})
+	assert.Error(t, err)
+
+	data, err := Marshal([]string{"1", "nope"})
+	assert.NoError(t, err)
+	var res []Event
+	assert.Error(t, Unmarshal(data, &res))
+}
+
+func TestEmbeddedInterface(t *testing.T) {
+	type S struct {
+		Event
+		Seq uint8
+	}
+	s := S{Event: Click{X: 1, Y: 2}, Seq: 3}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+}
+
+func TestDecodeIntoEmptyInterface(t *testing.T) {
+	var in interface{} = Click{X: 3, Y: 4}
+	data, err := Marshal(&in)
+	assert.NoError(t, err)
+
+	var out interface{}
+	assert.NoError(t, Unmarshal(data, &out))
+	assert.Equal(t, in, out)
+
+	in = &KeyPress{Key: "q"}
+	data, err = Marshal(&in)
+	assert.NoError(t, err)
+	out = nil
+	assert.NoError(t, Unmarshal(data, &out))
+	assert.Equal(t, in, out)
+
+	// A concrete value passed directly is encoded without its type name.
+	data, err = Marshal(Click{X: 3, Y: 4})
+	assert.NoError(t, err)
+	assert.Error(t, Unmarshal(data, &out))
+}
+
+func TestNilInterface(t *testing.T) {
+	type S struct {
+		Event Event
+		Seq   uint8
+	}
+	data, err := Marshal(S{Seq: 7})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 7}, data)
+
+	res := S{Event: Click{1, 2}}
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, S{Seq: 7}, res)
+
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+
+	events := []Event{Click{1, 2}, nil, &KeyPress{"a"}}
+	data, err = Marshal(events)
+	assert.NoError(t, err)
+	var out []Event
+	assert.NoError(t, Unmarshal(data, &out))
+	assert.Equal(t, events, out)
+}
+
+func TestMapOfInterfaces(t *testing.T) {
+	// The builtin types are registered by the package.
+	m := map[string]interface{}{
+		"name":  "ada",
+		"count": 3,
+		"ratio": 0.5,
+		"raw":   []byte{1, 2},
+		"ok":    true,
+		"click": Click{1, 2},
+		"key":   &KeyPress{"k"},
+		"none":  nil,
+	}
+	data, err := Marshal(m)
+	assert.NoError(t, err)
+	var res map[string]interface{}
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, m, res)
+
+	m["bad"] = []float64{1.5}
+	_, err = Marshal(m)
+	assert.EqualError(t, err, "binary: field [bad]: type not registered for interface: []float64")
+}
+
+func TestInterfaceNameIgnoresStringCodec(t *testing.T) {
+	// Type names are not strings of the encoded value, so a codec for
+	// string applies to KeyPress.Key but not to the name of its type.
+	RegisterCodec(stringType,
+		func(e *Encoder, rv reflect.Value) error {
+			_, err := e.w.Write([]byte{'!', byte(rv.Len())})
+			if err == nil {
+				_, err = io.WriteString(e.w, rv.String())
+			}
+			return err
+		},
+		func(d *Decoder, rv reflect.Value) error {
+			buf, err := d.readFixed(2)
+			if err != nil {
+				return err
+			}
+			if buf[0] != '!' {
+				return errors.New("missing codec marker")
+			}
+			b := make([]byte, buf[1])
+			_, err = io.ReadFull(d.r, b)
+			rv.SetString(string(b))
+			return err
+		})
+	t.Cleanup(func() { codecs.Delete(stringType) })
+
+	var in Event = &KeyPress{Key: "q"}
+	data, err := Marshal(&in)
+	assert.NoError(t, err)
+	name := "*github.com/alecthomas/binary.KeyPress"
+	assert.Equal(t, append(append([]byte{byte(len(name))}, name...), 1, '!', 1, 'q'), data)
+	var out Event
+	assert.NoError(t, Unmarshal(data, &out))
+	assert.Equal(t, in, out)
+}
@@ -0,0 +1,270 @@
+package binary
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+)
+
+var (
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+	textUnmarshalerType   = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Skip advances the decoder past the next encoded value without decoding
+// it. v determines the type of the value to skip and, as with Decode, is
+// typically a pointer to that type.
+func (d *Decoder) Skip(v interface{}) error {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return errors.New("binary: cannot Skip nil")
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return d.SkipType(t)
+}
+
+// SkipType advances the decoder past the next encoded value of type t.
+func (d *Decoder) SkipType(t reflect.Type) (err error) {
+	defer recoverPanic(&err)
+	if d.TrackRefs && d.refs == nil {
+		d.refs = []reflect.Value{{}}
+		defer func() { d.refs = nil }()
+	}
+	if d.MaxBytes > 0 && d.r.limit == 0 {
+		d.r.limit = d.r.n + int64(d.MaxBytes)
+		defer func() { d.r.limit = 0 }()
+	}
+	start := d.r.n
+	return d.unexpectedEOF(start, d.skipValue(t))
+}
+
+// discard reads and discards n bytes.
+func (d *Decoder) discard(n int) error {
+	_, err := io.CopyN(io.Discard, d.r, int64(n))
+	return err
+}
+
+// skipValue mirrors decodeValue, consuming the encoded form of a value of
+// type t without storing it.
+func (d *Decoder) skipValue(t reflect.Type) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+
+	if c, ok := lookupCodec(t); ok {
+		// Codecs have no way of skipping, so decode into a throwaway value.
+		return c.dec(d, reflect.New(t).Elem())
+	}
+	if t.Kind() == reflect.Ptr {
+		return d.skipPtr(t)
+	}
+	switch t {
+	case uint8Type, int8Type:
+		_, err := d.r.ReadByte()
+		return err
+
+	case durationType:
+		return d.discard(8)
+
+	case bytesType, ipType, rawValueType, blobType:
+		l, _, err := d.readSliceLen()
+		if err != nil {
+			return err
+		}
+		return d.discard(l)
+
+	case bufferType:
+		l, err := d.readLen()
+		if err != nil {
+			return err
+		}
+		return d.discard(l)
+
+	case syncMapType:
+		return d.skipSyncMap()
+	}
+	if nullTypes[t] {
+		return d.skipNull(t)
+	}
+
+	if t.Kind() != reflect.Interface {
+		if pt := reflect.PtrTo(t); pt.Implements(binaryUnmarshalerType) || pt.Implements(textUnmarshalerType) {
+			l, err := d.readLen()
+			if err != nil {
+				return err
+			}
+			return d.discard(l)
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Array:
+		l := t.Len()
+		if d.ArrayLengths {
+			var err error
+			if l, err = d.readArrayLen(t); err != nil {
+				return err
+			}
+		}
+		return d.skipArrayTail(t, 0, l)
+
+	case reflect.Slice:
+		l, _, err := d.readSliceLen()
+		if err != nil {
+			return err
+		}
+		if isByteType(t.Elem()) {
+			return d.discard(l)
+		}
+		for i := 0; i < l; i++ {
+			if err := d.skipValue(t.Elem()); err != nil {
+				return withIndex(err, i)
+			}
+		}
+
+	case reflect.Struct:
+		return d.skipFields(t)
+
+	case reflect.Map:
+		l, _, err := d.readSliceLen()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < l; i++ {
+			if err := d.skipValue(t.Key()); err != nil {
+				return withMapEntry(withIndex(err, i), i, l)
+			}
+			if err := d.skipValue(t.Elem()); err != nil {
+				return withMapEntry(withIndex(err, i), i, l)
+			}
+		}
+
+	case reflect.Interface:
+		return d.skipInterface()
+
+	case reflect.String:
+		l, err := d.readLen()
+		if err != nil {
+			return err
+		}
+		return d.discard(l)
+
+	case reflect.Bool:
+		return d.discard(1)
+
+	case reflect.Int, reflect.Uint:
+		n, err := intSize(d.IntSize)
+		if err != nil {
+			return err
+		}
+		return d.discard(n)
+
+	case reflect.Uintptr:
+		return d.discard(8)
+
+	case reflect.Int8, reflect.Uint8, reflect.Int16, reflect.Uint16,
+		reflect.Int32, reflect.Uint32, reflect.Int64, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return d.discard(int(t.Size()))
+
+	default:
+		return errors.New("binary: unsupported type " + t.String())
+	}
+	return nil
+}
+
+// skipArrayTail skips elements i through l-1 of an array of type t.
+func (d *Decoder) skipArrayTail(t reflect.Type, i, l int) error {
+	if isByteType(t.Elem()) {
+		return d.discard(l - i)
+	}
+	for ; i < l; i++ {
+		if err := d.skipValue(t.Elem()); err != nil {
+			return withIndex(err, i)
+		}
+	}
+	return nil
+}
+
+// skipFields skips the fields of struct type t.
+func (d *Decoder) skipFields(t reflect.Type) error {
+	fields := structFields(t)
+	if isTagged(fields) {
+		return d.skipTaggedFields()
+	}
+	if isNamed(fields) {
+		return d.skipNamedFields()
+	}
+	present, err := d.readPresence(fields)
+	if err != nil {
+		return err
+	}
+	k := 0
+	for _, f := range fields {
+		if f.unexported && !d.IncludeUnexported {
+			continue
+		}
+		if f.optional {
+			k++
+			if !isPresent(present, k-1) {
+				continue
+			}
+		}
+		ft := t.Field(f.index).Type
+		var err error
+		switch {
+		case f.inline:
+			err = d.skipFields(ft)
+		case f.varint:
+			_, err = binary.ReadUvarint(d.r)
+		case f.bitset:
+			var l int
+			if l, _, err = d.readSliceLen(); err == nil {
+				err = d.discard((l + 7) / 8)
+			}
+		case f.unixnano:
+			err = d.discard(8)
+		case f.asFloat32:
+			err = d.discard(4)
+		case f.fixed != 0:
+			if err = checkFixed(ft, f.fixed); err == nil {
+				err = d.discard(f.fixed)
+			}
+		case ft.Kind() == reflect.Ptr:
+			err = d.skipPtr(ft)
+		default:
+			err = d.skipValue(ft)
+		}
+		if err != nil {
+			if f.inline {
+				return err
+			}
+			return withField(err, f.name)
+		}
+	}
+	return nil
+}
+
+// skipPtr skips a presence byte and, if set, the value of pointer type t,
+// or the value written by a codec registered for t.
+func (d *Decoder) skipPtr(t reflect.Type) error {
+	if c, ok := lookupCodec(t); ok {
+		return c.dec(d, reflect.New(t).Elem())
+	}
+	if d.TrackRefs {
+		return d.skipRef(t)
+	}
+	present, err := d.r.ReadByte()
+	if err != nil || present == 0 {
+		return err
+	}
+	if t.Elem().Kind() == reflect.Ptr {
+		return d.skipPtr(t.Elem())
+	}
+	return d.skipValue(t.Elem())
+}
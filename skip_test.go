@@ -0,0 +1,64 @@
+package binary
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecoderSkip(t *testing.T) {
+	type Inner struct {
+		N   int32 `binary:"varint"`
+		Ptr *string
+	}
+	type Skipped struct {
+		Name     string
+		Inners   []Inner
+		Lookup   map[string][]uint16
+		Array    [3]bool
+		When     time.Time
+		Wait     time.Duration
+		Blob     []byte
+		Event    Event
+		Nested   **Inner
+		Ignored  string `binary:"-"`
+		Complex  complex128
+		Fallback textOnly
+	}
+	s := "pointer"
+	inner := &Inner{N: -5, Ptr: &s}
+	first := Skipped{
+		Name:     "skipped",
+		Inners:   []Inner{{N: 1}, {N: 300, Ptr: &s}},
+		Lookup:   map[string][]uint16{"a": {1, 2}, "b": nil},
+		Array:    [3]bool{true, false, true},
+		When:     time.Date(2013, 1, 2, 3, 4, 5, 6, time.UTC),
+		Wait:     time.Minute,
+		Blob:     []byte{1, 2, 3},
+		Event:    &KeyPress{"q"},
+		Nested:   &inner,
+		Complex:  1 + 2i,
+		Fallback: textOnly{"a", "b"},
+	}
+
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	assert.NoError(t, enc.Encode(first))
+	assert.NoError(t, enc.Encode(s0v))
+
+	dec := NewDecoder(buf)
+	assert.NoError(t, dec.Skip(&Skipped{}))
+	res := &s0{}
+	assert.NoError(t, dec.Decode(res))
+	assert.Equal(t, s0v, res)
+	assert.Equal(t, io.EOF, dec.SkipType(reflect.TypeOf(s0{})))
+
+	data, err := Marshal(first)
+	assert.NoError(t, err)
+	dec = NewDecoder(bytes.NewReader(data[:len(data)-1]))
+	assert.Equal(t, io.ErrUnexpectedEOF, dec.Skip(&Skipped{}))
+}
@@ -0,0 +1,90 @@
+package binary
+
+import (
+	"errors"
+	"io"
+	"reflect"
+)
+
+// Stream decodes consecutive values from r in a new goroutine, sending each
+// on the returned value channel. Each value is decoded into a newly allocated
+// instance of the type of proto, so consumers may retain them. If proto is a
+// pointer, pointers to fresh values of the type it points to are sent
+// instead.
+//
+// Both channels are closed when the input ends cleanly between values. Any
+// other error, including io.ErrUnexpectedEOF if the input ends part way
+// through a value, is sent on the error channel before both are closed. The
+// value channel must be read until it is closed, or the goroutine will leak.
+func Stream(r io.Reader, proto interface{}) (<-chan interface{}, <-chan error) {
+	values := make(chan interface{})
+	errs := make(chan error, 1)
+	t := reflect.TypeOf(proto)
+	go func() {
+		defer close(errs)
+		defer close(values)
+		if t == nil {
+			errs <- errors.New("binary: cannot Stream nil")
+			return
+		}
+		ptr := t.Kind() == reflect.Ptr
+		if ptr {
+			t = t.Elem()
+		}
+		d := NewDecoder(r)
+		for {
+			rv := reflect.New(t)
+			if err := d.DecodeValue(rv); err == io.EOF {
+				return
+			} else if err != nil {
+				errs <- err
+				return
+			}
+			if ptr {
+				values <- rv.Interface()
+			} else {
+				values <- rv.Elem().Interface()
+			}
+		}
+	}()
+	return values, errs
+}
+
+// DecodeInto reads a slice, as written by encoding a []T, sending each
+// element on ch, which must be a chan T or chan<- T. The elements are sent as
+// they are decoded, blocking until ch accepts each one, and ch is not closed
+// afterwards.
+func (d *Decoder) DecodeInto(ch interface{}) (err error) {
+	defer recoverPanic(&err)
+	if ch == nil {
+		return errors.New("binary: cannot DecodeInto nil")
+	}
+	rv := reflect.ValueOf(ch)
+	if rv.Kind() != reflect.Chan || rv.Type().ChanDir()&reflect.SendDir == 0 {
+		return errors.New("binary: can only DecodeInto a sendable channel, not " + reflect.TypeOf(ch).String())
+	}
+	if rv.IsNil() {
+		return errors.New("binary: cannot DecodeInto nil channel of type " + rv.Type().String())
+	}
+	if d.TrackRefs && d.refs == nil {
+		d.refs = []reflect.Value{{}}
+		defer func() { d.refs = nil }()
+	}
+	if d.MaxBytes > 0 && d.r.limit == 0 {
+		d.r.limit = d.r.n + int64(d.MaxBytes)
+		defer func() { d.r.limit = 0 }()
+	}
+	start := d.r.n
+	l, _, err := d.readSliceLen()
+	if err != nil {
+		return d.unexpectedEOF(start, err)
+	}
+	for i := 0; i < l; i++ {
+		v := reflect.New(rv.Type().Elem()).Elem()
+		if err := d.decodeValue(v); err != nil {
+			return d.unexpectedEOF(start, withIndex(err, i))
+		}
+		rv.Send(v)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package binary
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream(t *testing.T) {
+	type Record struct {
+		ID   int
+		Tags []string
+	}
+	records := []Record{{1, []string{"a"}}, {2, nil}, {3, []string{"b", "c"}}}
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	for _, r := range records {
+		assert.NoError(t, enc.Encode(r))
+	}
+	data := buf.Bytes()
+
+	values, errs := Stream(bytes.NewReader(data), Record{})
+	var got []Record
+	for v := range values {
+		got = append(got, v.(Record))
+	}
+	assert.NoError(t, <-errs)
+	records[1].Tags = []string{}
+	assert.Equal(t, records, got)
+
+	// Pointer prototypes yield distinct pointers.
+	values, errs = Stream(bytes.NewReader(data), &Record{})
+	var ptrs []*Record
+	for v := range values {
+		ptrs = append(ptrs, v.(*Record))
+	}
+	assert.NoError(t, <-errs)
+	assert.Equal(t, 3, len(ptrs))
+	for i, p := range ptrs {
+		assert.Equal(t, records[i], *p)
+	}
+	assert.True(t, ptrs[0] != ptrs[1])
+}
+
+func TestStreamTruncated(t *testing.T) {
+	data, err := Marshal([]string{"first", "second"})
+	assert.NoError(t, err)
+	data = append(data, data[:3]...)
+
+	values, errs := Stream(bytes.NewReader(data), []string{})
+	var n int
+	for range values {
+		n++
+	}
+	assert.Equal(t, 1, n)
+	assert.Equal(t, io.ErrUnexpectedEOF, <-errs)
+
+	values, errs = Stream(bytes.NewReader(nil), nil)
+	_, ok := <-values
+	assert.False(t, ok)
+	assert.EqualError(t, <-errs, "binary: cannot Stream nil")
+}
+
+func TestDecodeInto(t *testing.T) {
+	data, err := Marshal([]int{1, 2, 3})
+	assert.NoError(t, err)
+	data = append(data, data...)
+
+	dec := NewDecoder(bytes.NewReader(data))
+	ch := make(chan int, 3)
+	assert.NoError(t, dec.DecodeInto(ch))
+	assert.Equal(t, 3, len(ch))
+	assert.Equal(t, 1, <-ch)
+	assert.Equal(t, 2, <-ch)
+	assert.Equal(t, 3, <-ch)
+
+	// Send-only channels work, and a consumer can drain them concurrently.
+	unbuffered := make(chan int)
+	var sendOnly chan<- int = unbuffered
+	done := make(chan []int)
+	go func() {
+		var got []int
+		for v := range unbuffered {
+			got = append(got, v)
+		}
+		done <- got
+	}()
+	assert.NoError(t, dec.DecodeInto(sendOnly))
+	close(unbuffered)
+	assert.Equal(t, []int{1, 2, 3}, <-done)
+	assert.Equal(t, io.EOF, dec.DecodeInto(ch))
+
+	assert.Equal(t, io.ErrUnexpectedEOF, NewDecoder(bytes.NewReader(data[:5])).DecodeInto(ch))
+	assert.EqualError(t, dec.DecodeInto(nil), "binary: cannot DecodeInto nil")
+	assert.EqualError(t, dec.DecodeInto([]int{}), "binary: can only DecodeInto a sendable channel, not []int")
+	assert.EqualError(t, dec.DecodeInto(make(<-chan int)), "binary: can only DecodeInto a sendable channel, not <-chan int")
+	assert.EqualError(t, dec.DecodeInto((chan int)(nil)), "binary: cannot DecodeInto nil channel of type chan int")
+}
+
+func TestDecodeIntoTrackRefs(t *testing.T) {
+	n := &node{Value: 5}
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.TrackRefs = true
+	assert.NoError(t, enc.Encode([]*node{n, n}))
+	assert.NoError(t, enc.Encode(n))
+
+	dec := NewDecoder(buf)
+	dec.TrackRefs = true
+	ch := make(chan *node, 8)
+	assert.NoError(t, dec.DecodeInto(ch))
+	close(ch)
+	var got []*node
+	for v := range ch {
+		got = append(got, v)
+	}
+	assert.Equal(t, []*node{n, n}, got)
+	assert.True(t, len(got) == 2 && got[0] == got[1])
+
+	// References from the slice do not leak into the next value.
+	var res node
+	assert.NoError(t, dec.Decode(&res))
+	assert.Equal(t, *n, res)
+}
+
+func TestDecodeIntoMaxBytes(t *testing.T) {
+	data, err := Marshal([]string{"hello", "world"})
+	assert.NoError(t, err)
+	dec := NewDecoder(bytes.NewReader(data))
+	dec.MaxBytes = len(data) - 1
+	assert.EqualError(t, dec.DecodeInto(make(chan string, 2)), "binary: field [1]: value exceeds MaxBytes")
+
+	dec = NewDecoder(bytes.NewReader(append(data, data...)))
+	dec.MaxBytes = len(data)
+	ch := make(chan string, 4)
+	assert.NoError(t, dec.DecodeInto(ch))
+	assert.NoError(t, dec.DecodeInto(ch))
+	assert.Equal(t, 4, len(ch))
+}
@@ -0,0 +1,92 @@
+package binary
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var syncMapType = reflect.TypeOf(sync.Map{})
+
+// encodeSyncMap writes the number of entries in the sync.Map rv followed by
+// each key and value. Keys and values are held as interface{}, so they are
+// written like interface values, with the registered name of their dynamic
+// type, and those types must be registered with Register. Entries are written
+// in no particular order, and SortKeys does not apply. rv must be
+// addressable, as a sync.Map must not be copied.
+func (b *Encoder) encodeSyncMap(rv reflect.Value) error {
+	if !rv.CanAddr() {
+		return errors.New("binary: sync.Map must be encoded through a pointer")
+	}
+	// Take a snapshot first, as the count must be written before the entries
+	// and the map may change while it is being ranged over.
+	var keys, values []interface{}
+	rv.Addr().Interface().(*sync.Map).Range(func(k, v interface{}) bool {
+		keys = append(keys, k)
+		values = append(values, v)
+		return true
+	})
+	if err := b.writeLen(len(keys)); err != nil {
+		return err
+	}
+	for i := range keys {
+		key := reflect.ValueOf(&keys[i]).Elem()
+		if err := b.encodeValue(key); err != nil {
+			return withKey(err, key)
+		}
+		if err := b.encodeValue(reflect.ValueOf(&values[i]).Elem()); err != nil {
+			return withKey(err, key)
+		}
+	}
+	return nil
+}
+
+// decodeSyncMap reads a sync.Map as written by Encoder.encodeSyncMap, storing
+// each entry in rv. The existing entries of rv are removed first unless
+// MergeMaps is set.
+func (d *Decoder) decodeSyncMap(rv reflect.Value) error {
+	l, err := d.readLen()
+	if err != nil {
+		return err
+	}
+	m := rv.Addr().Interface().(*sync.Map)
+	if !d.MergeMaps {
+		m.Range(func(k, _ interface{}) bool {
+			m.Delete(k)
+			return true
+		})
+	}
+	for i := 0; i < l; i++ {
+		var k, v interface{}
+		key := reflect.ValueOf(&k).Elem()
+		if err := d.decodeValue(key); err != nil {
+			return withMapEntry(withIndex(err, i), i, l)
+		}
+		if !key.IsNil() && !key.Elem().Type().Comparable() {
+			return withMapEntry(withIndex(fmt.Errorf("binary: sync.Map key of type %s is not comparable", key.Elem().Type()), i), i, l)
+		}
+		if err := d.decodeValue(reflect.ValueOf(&v).Elem()); err != nil {
+			return withMapEntry(withKey(err, key), i, l)
+		}
+		m.Store(k, v)
+	}
+	return nil
+}
+
+// skipSyncMap skips a sync.Map as written by Encoder.encodeSyncMap.
+func (d *Decoder) skipSyncMap() error {
+	l, err := d.readLen()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < l; i++ {
+		if err := d.skipInterface(); err != nil {
+			return withMapEntry(withIndex(err, i), i, l)
+		}
+		if err := d.skipInterface(); err != nil {
+			return withMapEntry(withIndex(err, i), i, l)
+		}
+	}
+	return nil
+}
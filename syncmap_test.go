@@ -0,0 +1,66 @@
+package binary
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// syncMapContents returns the entries of m as a plain map.
+func syncMapContents(m *sync.Map) map[interface{}]interface{} {
+	out := map[interface{}]interface{}{}
+	m.Range(func(k, v interface{}) bool {
+		out[k] = v
+		return true
+	})
+	return out
+}
+
+func TestSyncMap(t *testing.T) {
+	var m sync.Map
+	m.Store("a", 1)
+	m.Store("b", 2)
+	m.Store("c", 3)
+	data, err := Marshal(&m)
+	assert.NoError(t, err)
+
+	var res sync.Map
+	res.Store("stale", 0)
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, map[interface{}]interface{}{"a": 1, "b": 2, "c": 3}, syncMapContents(&res))
+
+	type S struct {
+		Cache sync.Map
+		N     int
+	}
+	s := &S{N: 7}
+	s.Cache.Store("x", 42)
+	data, err = Marshal(s)
+	assert.NoError(t, err)
+	var rs S
+	assert.NoError(t, Unmarshal(data, &rs))
+	assert.Equal(t, 7, rs.N)
+	assert.Equal(t, map[interface{}]interface{}{"x": 42}, syncMapContents(&rs.Cache))
+
+	d := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, d.SkipType(reflect.TypeOf(sync.Map{})))
+	var n int
+	assert.NoError(t, d.Decode(&n))
+	assert.Equal(t, 7, n)
+}
+
+func TestSyncMapUnregistered(t *testing.T) {
+	var m sync.Map
+	m.Store("a", []float64{1.5})
+	_, err := Marshal(&m)
+	assert.EqualError(t, err, "binary: field [a]: type not registered for interface: []float64")
+}
+
+func TestSyncMapNotAddressable(t *testing.T) {
+	// Map elements cannot be addressed, and a sync.Map must not be copied.
+	_, err := Marshal(map[string]sync.Map{"a": {}})
+	assert.EqualError(t, err, "binary: field [a]: sync.Map must be encoded through a pointer")
+}
@@ -0,0 +1,241 @@
+package binary
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// tagIndex returns the index given by a positive integer option in the
+// `binary` tag of f, or zero if there is none.
+func tagIndex(f reflect.StructField) int {
+	for _, o := range strings.Split(f.Tag.Get("binary"), ",") {
+		if n, err := strconv.Atoi(o); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+// isTagged reports whether any of fields has an index, making the struct they
+// belong to a tagged struct.
+func isTagged(fields []field) bool {
+	for _, f := range fields {
+		if f.tag != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTags checks that each field of the tagged struct type t that is to be
+// encoded has a distinct index.
+func checkTags(t reflect.Type, fields []field, includeUnexported bool) error {
+	names := map[int]string{}
+	for _, f := range fields {
+		if f.unexported && !includeUnexported {
+			continue
+		}
+		if f.tag == 0 {
+			return fmt.Errorf("binary: field %s of tagged struct %s has no index", f.name, t)
+		}
+		if f.named != "" {
+			return fmt.Errorf("binary: field %s of tagged struct %s has a name tag", f.name, t)
+		}
+		if name, ok := names[f.tag]; ok {
+			return fmt.Errorf("binary: fields %s and %s of %s have the same index %d", name, f.name, t, f.tag)
+		}
+		names[f.tag] = f.name
+	}
+	return nil
+}
+
+// encodeTaggedFields writes the number of fields of the addressable tagged
+// struct rv, followed by each field's index and length-prefixed value.
+func (b *Encoder) encodeTaggedFields(rv reflect.Value, fields []field) error {
+	if err := checkTags(rv.Type(), fields, b.IncludeUnexported); err != nil {
+		return err
+	}
+	n := 0
+	for _, f := range fields {
+		if b.taggedFieldPresent(rv, f) {
+			n++
+		}
+	}
+	if err := b.writeLen(n); err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	for _, f := range fields {
+		if !b.taggedFieldPresent(rv, f) {
+			continue
+		}
+		if err := b.writeVarint(f.tag); err != nil {
+			return err
+		}
+		if err := b.encodeDelimited(buf, f, fieldValue(rv, f)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeDelimited writes the value v of the struct field f with a length
+// prefix, encoding it into buf first to find its length. With TrackRefs, the
+// length is followed by the number of references the value registers.
+func (b *Encoder) encodeDelimited(buf *bytes.Buffer, f field, v reflect.Value) error {
+	w := b.w
+	defer func() { b.w = w }()
+	buf.Reset()
+	b.w = buf
+	refs := len(b.refs)
+	err := b.encodeField(f, v)
+	b.w = w
+	if err != nil {
+		return withField(err, f.name)
+	}
+	if err := b.writeLen(buf.Len()); err != nil {
+		return err
+	}
+	if b.TrackRefs {
+		if err := b.writeLen(len(b.refs) - refs); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// taggedFieldPresent reports whether the field f of the tagged or named
+// struct rv is to be written.
+func (b *Encoder) taggedFieldPresent(rv reflect.Value, f field) bool {
+	if f.unexported && !b.IncludeUnexported {
+		return false
+	}
+	return !f.optional || !fieldValue(rv, f).IsZero()
+}
+
+// decodeTaggedFields reads a tagged struct as written by
+// Encoder.encodeTaggedFields into the addressable struct rv. Fields that are
+// not present are set to zero, and those with unknown indices are skipped.
+func (d *Decoder) decodeTaggedFields(rv reflect.Value, fields []field) error {
+	if err := checkTags(rv.Type(), fields, d.IncludeUnexported); err != nil {
+		return err
+	}
+	byTag := make(map[uint64]field, len(fields))
+	for _, f := range fields {
+		if f.unexported && !d.IncludeUnexported {
+			continue
+		}
+		byTag[uint64(f.tag)] = f
+		fieldValue(rv, f).Set(reflect.Zero(rv.Type().Field(f.index).Type))
+	}
+	n, err := d.readLen()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		tag, err := binary.ReadUvarint(d.r)
+		if err != nil {
+			return err
+		}
+		l, err := d.readLen()
+		if err != nil {
+			return err
+		}
+		refs, err := d.readFieldRefs(l)
+		if err != nil {
+			return err
+		}
+		f, ok := byTag[tag]
+		if !ok {
+			if err := d.skipDelimited(l, refs); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.decodeDelimited(f, fieldValue(rv, f), l, refs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFieldRefs reads the number of references registered by a tagged or
+// named field of l bytes, which is only written with TrackRefs. Each takes at
+// least a byte, so there can be no more than l of them.
+func (d *Decoder) readFieldRefs(l int) (int, error) {
+	if !d.TrackRefs {
+		return 0, nil
+	}
+	n, err := d.readLen()
+	if err != nil {
+		return 0, err
+	}
+	if n > l {
+		return 0, fmt.Errorf("binary: %d references in a field of %d bytes", n, l)
+	}
+	return n, nil
+}
+
+// skipDelimited skips a tagged or named field of l bytes, reserving numbers
+// for the refs references it registers so that later references still match.
+func (d *Decoder) skipDelimited(l, refs int) error {
+	if err := d.discard(l); err != nil {
+		return err
+	}
+	for i := 0; i < refs; i++ {
+		d.refs = append(d.refs, reflect.Value{})
+	}
+	return nil
+}
+
+// decodeDelimited decodes the value v of the struct field f, which must take
+// up exactly the next l bytes of input and register refs references.
+func (d *Decoder) decodeDelimited(f field, v reflect.Value, l, refs int) error {
+	r := d.r
+	defer func() { d.r = r }()
+	d.r = &byteReader{Reader: io.LimitReader(r, int64(l))}
+	before := len(d.refs)
+	err := d.decodeField(f, v)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	} else if unread := int64(l) - d.r.n; err == nil && unread != 0 {
+		err = fmt.Errorf("binary: %d unread bytes in value", unread)
+	} else if n := len(d.refs) - before; err == nil && n != refs {
+		err = fmt.Errorf("binary: %d references in value, expected %d", n, refs)
+	}
+	if err != nil {
+		return withField(err, f.name)
+	}
+	return nil
+}
+
+// skipTaggedFields skips a tagged struct.
+func (d *Decoder) skipTaggedFields() error {
+	n, err := d.readLen()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		if _, err := binary.ReadUvarint(d.r); err != nil {
+			return err
+		}
+		l, err := d.readLen()
+		if err != nil {
+			return err
+		}
+		refs, err := d.readFieldRefs(l)
+		if err != nil {
+			return err
+		}
+		if err := d.skipDelimited(l, refs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
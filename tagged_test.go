@@ -0,0 +1,143 @@
+package binary
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type taggedV1 struct {
+	ID    int64    `binary:"1"`
+	Name  string   `binary:"2"`
+	Score int      `binary:"3,varint"`
+	Tags  []string `binary:"4"`
+}
+
+// taggedV2 reorders the fields of taggedV1, removes Score and adds Email.
+type taggedV2 struct {
+	Name  string   `binary:"2"`
+	Email string   `binary:"5"`
+	ID    int64    `binary:"1"`
+	Tags  []string `binary:"4"`
+}
+
+func TestTaggedFields(t *testing.T) {
+	v1 := taggedV1{ID: 7, Name: "bob", Score: -3, Tags: []string{"a"}}
+	data, err := Marshal(v1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{
+		4,
+		1, 8, 7, 0, 0, 0, 0, 0, 0, 0,
+		2, 4, 3, 'b', 'o', 'b',
+		3, 1, 5,
+		4, 3, 1, 1, 'a',
+	}, data)
+
+	var res1 taggedV1
+	assert.NoError(t, Unmarshal(data, &res1))
+	assert.Equal(t, v1, res1)
+
+	// Newer readers skip removed fields and leave added ones zero.
+	v2 := taggedV2{Email: "stale"}
+	assert.NoError(t, Unmarshal(data, &v2))
+	assert.Equal(t, taggedV2{ID: 7, Name: "bob", Tags: []string{"a"}}, v2)
+
+	// Older readers do the same in reverse.
+	v2.Email = "bob@example.com"
+	data, err = Marshal(v2)
+	assert.NoError(t, err)
+	res1 = taggedV1{Score: 100}
+	assert.NoError(t, Unmarshal(data, &res1))
+	assert.Equal(t, taggedV1{ID: 7, Name: "bob", Tags: []string{"a"}}, res1)
+
+	dec := NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, dec.Skip(&res1))
+	assert.Equal(t, io.EOF, dec.Decode(&res1))
+}
+
+func TestTaggedFieldsNested(t *testing.T) {
+	type S struct {
+		Before  string
+		Records []taggedV1
+		Ptr     *taggedV2
+		After   uint16
+	}
+	s := S{Before: "x", Records: []taggedV1{{ID: 1, Tags: []string{}}, {Name: "n", Tags: []string{"t"}}}, Ptr: &taggedV2{Email: "e", Tags: []string{}}, After: 9}
+	data, err := Marshal(s)
+	assert.NoError(t, err)
+	var res S
+	assert.NoError(t, Unmarshal(data, &res))
+	assert.Equal(t, s, res)
+	assert.NoError(t, Valid(s))
+}
+
+func TestTaggedFieldsErrors(t *testing.T) {
+	type missing struct {
+		A int `binary:"1"`
+		B int
+	}
+	_, err := Marshal(missing{})
+	assert.EqualError(t, err, "binary: field B of tagged struct binary.missing has no index")
+	assert.EqualError(t, Valid(missing{}), "binary: field B of tagged struct binary.missing has no index")
+
+	type duplicate struct {
+		A int `binary:"1"`
+		B int `binary:"1"`
+	}
+	_, err = Marshal(duplicate{})
+	assert.EqualError(t, err, "binary: fields A and B of binary.duplicate have the same index 1")
+
+	// A value that does not fill its field's frame is an error.
+	data, err := Marshal(taggedV1{Name: "bob"})
+	assert.NoError(t, err)
+	data[12] = 3
+	var res taggedV1
+	assert.Equal(t, io.ErrUnexpectedEOF, Unmarshal(data, &res))
+	data[12] = 4
+	data[13] = 2
+	assert.EqualError(t, Unmarshal(data, &res), "binary: field Name: 1 unread bytes in value")
+
+	data, err = Marshal(taggedV1{ID: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, io.ErrUnexpectedEOF, Unmarshal(data[:len(data)-1], &res))
+}
+
+func TestTaggedFieldsTrackRefs(t *testing.T) {
+	type V2 struct {
+		A *node `binary:"1"`
+		X *node `binary:"2"`
+		Y *node `binary:"3"`
+		Z *node `binary:"4"`
+	}
+	// V1 lacks X, so the references first written within it are skipped.
+	type V1 struct {
+		A *node `binary:"1"`
+		Y *node `binary:"3"`
+		Z *node `binary:"4"`
+	}
+	shared := &node{Value: 2}
+	v := V2{A: &node{Value: 1}, X: &node{Value: 9, Next: &node{Value: 10}}, Y: shared, Z: shared}
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	enc.TrackRefs = true
+	assert.NoError(t, enc.Encode(v))
+	assert.NoError(t, enc.Encode(v))
+
+	dec := NewDecoder(buf)
+	dec.TrackRefs = true
+	var res V1
+	assert.NoError(t, dec.Decode(&res))
+	assert.Equal(t, int8(1), res.A.Value)
+	assert.Equal(t, int8(2), res.Y.Value)
+	assert.True(t, res.Y == res.Z)
+	assert.NoError(t, dec.Skip(&res))
+	assert.Equal(t, io.EOF, dec.Decode(&res))
+
+	// A reference into a skipped field cannot be resolved.
+	v.Y = v.X
+	buf.Reset()
+	assert.NoError(t, enc.Encode(v))
+	assert.EqualError(t, dec.Decode(&res), "binary: field Y: reference 2 is to a skipped value")
+}
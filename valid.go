@@ -0,0 +1,127 @@
+package binary
+
+import (
+	"errors"
+	"reflect"
+)
+
+// Valid checks that values of the type of v can be encoded by an Encoder with
+// the default settings, without encoding anything. It walks the type rather
+// than a value, so every unsupported type is found even when the field
+// holding it is nil or empty, and all of them are reported together as
+// errors joined by errors.Join, each with the path of the field holding it.
+// The dynamic types of values held in interfaces are only known when a value
+// is encoded, so they are not checked.
+func Valid(v interface{}) error {
+	if v == nil {
+		return errors.New("binary: cannot encode nil value")
+	}
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var errs []error
+	checkType(t, map[reflect.Type]bool{}, func(err error) { errs = append(errs, err) })
+	return errors.Join(errs...)
+}
+
+// checkType mirrors Encoder.encodeValue, calling report for each unsupported
+// type reachable from t. Types in seen are being checked further up, so
+// checking them again would recurse forever.
+func checkType(t reflect.Type, seen map[reflect.Type]bool, report func(error)) {
+	if seen[t] {
+		return
+	}
+	seen[t] = true
+	defer delete(seen, t)
+	if _, ok := lookupCodec(t); ok {
+		return
+	}
+	if t.Kind() == reflect.Ptr {
+		checkType(t.Elem(), seen, report)
+		return
+	}
+	switch t {
+	case durationType, bytesType, ipType, rawValueType, bufferType, blobType, syncMapType:
+		return
+	}
+	if nullTypes[t] {
+		return
+	}
+	if t.Kind() != reflect.Interface {
+		if implementsMarshaler(t) || implementsMarshaler(reflect.PtrTo(t)) {
+			return
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Array, reflect.Slice:
+		checkType(t.Elem(), seen, func(err error) { report(withPath(err, "[]")) })
+
+	case reflect.Map:
+		checkType(t.Key(), seen, func(err error) { report(withPath(err, "[key]")) })
+		checkType(t.Elem(), seen, func(err error) { report(withPath(err, "[]")) })
+
+	case reflect.Struct:
+		checkFields(t, seen, report)
+
+	case reflect.Interface, reflect.String,
+		reflect.Bool, reflect.Int, reflect.Uint, reflect.Uintptr,
+		reflect.Int8, reflect.Uint8, reflect.Int16, reflect.Uint16,
+		reflect.Int32, reflect.Uint32, reflect.Int64, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+
+	default:
+		report(errors.New("binary: unsupported type " + t.String()))
+	}
+}
+
+// checkFields mirrors Encoder.encodeFields for checkType.
+func checkFields(t reflect.Type, seen map[reflect.Type]bool, report func(error)) {
+	fields := structFields(t)
+	if isTagged(fields) {
+		if err := checkTags(t, fields, false); err != nil {
+			report(err)
+		}
+	} else if isNamed(fields) {
+		if err := checkNames(t, fields, false); err != nil {
+			report(err)
+		}
+	}
+	for _, f := range fields {
+		if f.unexported {
+			continue
+		}
+		ft := t.Field(f.index).Type
+		fieldReport := func(err error) { report(withField(err, f.name)) }
+		switch {
+		case f.inline:
+			checkFields(ft, seen, report)
+		case f.varint:
+			switch ft.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			default:
+				fieldReport(errors.New("binary: varint tag on non-integer type " + ft.String()))
+			}
+		case f.bitset:
+			if ft.Kind() != reflect.Slice || ft.Elem().Kind() != reflect.Bool {
+				fieldReport(errors.New("binary: bitset tag on non-[]bool type " + ft.String()))
+			}
+		case f.unixnano:
+			if ft != timeType {
+				fieldReport(errors.New("binary: unixnano tag on non-time.Time type " + ft.String()))
+			}
+		case f.asFloat32:
+			if ft.Kind() != reflect.Float64 {
+				fieldReport(errors.New("binary: float32 tag on non-float64 type " + ft.String()))
+			}
+		case f.fixed != 0:
+			if err := checkFixed(ft, f.fixed); err != nil {
+				fieldReport(err)
+			}
+		default:
+			checkType(ft, seen, fieldReport)
+		}
+	}
+}
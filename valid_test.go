@@ -0,0 +1,57 @@
+package binary
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValid(t *testing.T) {
+	type node struct {
+		Name     string
+		Children []node
+		Parent   *node
+	}
+	assert.NoError(t, Valid(s1v))
+	assert.NoError(t, Valid(*s1v))
+	assert.NoError(t, Valid(node{}))
+	assert.NoError(t, Valid(struct {
+		Iface  interface{}
+		Ignore func() `binary:"-"`
+		hidden chan int
+	}{}))
+	assert.EqualError(t, Valid(nil), "binary: cannot encode nil value")
+}
+
+func TestValidReportsAllFields(t *testing.T) {
+	type inner struct {
+		Callback func()
+	}
+	type S struct {
+		Name     string
+		OnChange func()
+		Events   chan int
+		Inner    *inner
+		Handlers map[string]func(int)
+		Count    string `binary:"varint"`
+	}
+	err := Valid(&S{})
+	assert.Error(t, err)
+	assert.Equal(t, []string{
+		"binary: field OnChange: unsupported type func()",
+		"binary: field Events: unsupported type chan int",
+		"binary: field Inner.Callback: unsupported type func()",
+		"binary: field Handlers[]: unsupported type func(int)",
+		"binary: field Count: varint tag on non-integer type string",
+	}, strings.Split(err.Error(), "\n"))
+
+	var fe *FieldError
+	assert.True(t, errors.As(err, &fe))
+	assert.Equal(t, "OnChange", fe.Path)
+
+	// Encoding reports the first of these.
+	_, err = Marshal(&S{OnChange: func() {}})
+	assert.EqualError(t, err, "binary: field OnChange: unsupported type func()")
+}